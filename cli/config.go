@@ -7,9 +7,12 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/mmbros/getstocks/run"
+	"github.com/mmbros/getstocks/workers"
 	"github.com/naoina/toml"
 )
 
@@ -20,9 +23,14 @@ const (
 	clGenConfig = "g"
 	clHelp      = "h"
 	clOutput    = "o"
+	clVerbose   = "v"
+	clRefresh   = "r"
+	clOffline   = "n"
 
 	// default values
 	defaultConfigFile = "data-crypt/getstocks.cfg"
+	defaultStateFile  = "data-crypt/getstocks.state"
+	defaultCacheDir   = "data-crypt/cache"
 	defaultOutputFile = "" // if empty use StdOut
 )
 
@@ -32,12 +40,260 @@ type clArgs struct {
 	genConfig bool
 	help      bool
 	output    string
+	verbose   bool
+	refresh   bool
+	offline   bool
+}
+
+// duration is a time.Duration that can be read from the config file
+// as a string, e.g. "1m30s".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
 }
 
 type configScraper struct {
 	Name     string
 	Workers  int
 	Disabled bool
+
+	// rate policy
+	RateRequests int
+	RateInterval duration
+	MinDelay     duration
+	Jitter       duration
+
+	// max duration of each request
+	Timeout duration
+
+	// retry policy
+	RetryAttempts   int
+	RetryBackoff    duration
+	RetryMaxBackoff duration
+	RetryJitter     duration
+
+	// circuit breaker: after the given consecutive failures, or failure
+	// rate of the last breaker_window requests, the scraper is skipped
+	// for breaker_open_timeout (or for the whole run, if not set)
+	BreakerFailures    int
+	BreakerRate        float64
+	BreakerWindow      int
+	BreakerOpenTimeout duration
+
+	// adaptive scaling: the active workers change between min_workers
+	// and workers, halved at a failure or a request slower than
+	// latency_target (if set)
+	MinWorkers    int
+	LatencyTarget duration
+
+	// max number of downloads per day (if set), cached and shared pages
+	// excluded, tracked across the runs in the state file
+	DailyQuota int
+
+	// batch scraper: the page with the quotes of many stocks, matched by
+	// isin, an additional source of the stocks with an isin (tried first
+	// in hedging mode). Its parser can't be defined in the config file:
+	// it must be registered in Go by run.RegisterBatchScraper.
+	BatchURL string
+
+	// declarative scraper: the price and date of the stock pages of the
+	// hosts (the name, if not set) are the text of the nth node (0 based)
+	// matching the css selector, optionally cleaned up by the first group
+	// of the regexp. The date is parsed with the layout and time zone.
+	Hosts         []string
+	PriceSelector string
+	PriceNth      int
+	PriceRegexp   string
+	DateSelector  string
+	DateNth       int
+	DateRegexp    string
+	DateLayout    string
+	TimeZone      string
+
+	// json scraper: the price, date and currency of the json pages
+	// are given by the path expressions, e.g. "$.data[0].price".
+	// The date is parsed with date_layout ("unix" or "unixms" for
+	// a timestamp) and time_zone.
+	PricePath    string
+	DatePath     string
+	CurrencyPath string
+
+	// http client settings, overriding the global ones
+	Client *configClient
+
+	// time the cached pages are used without asking the server,
+	// overriding the global cache_ttl
+	CacheTTL duration
+}
+
+func (scr *configScraper) rateLimit() workers.RateLimit {
+	return workers.RateLimit{
+		Requests: scr.RateRequests,
+		Interval: scr.RateInterval.Duration,
+		MinDelay: scr.MinDelay.Duration,
+		Jitter:   scr.Jitter.Duration,
+	}
+}
+
+func (scr *configScraper) circuitBreaker() workers.CircuitBreaker {
+	return workers.CircuitBreaker{
+		ConsecutiveFailures: scr.BreakerFailures,
+		FailureRate:         scr.BreakerRate,
+		Window:              scr.BreakerWindow,
+		OpenTimeout:         scr.BreakerOpenTimeout.Duration,
+	}
+}
+
+func (scr *configScraper) scaling() workers.Scaling {
+	return workers.Scaling{
+		MinInstances: scr.MinWorkers,
+		Latency:      scr.LatencyTarget.Duration,
+	}
+}
+
+// selectorScraper returns the definition of the declarative scraper,
+// or nil if not declarative.
+func (scr *configScraper) selectorScraper() *run.SelectorScraper {
+	if scr.PriceSelector == "" && scr.DateSelector == "" {
+		return nil
+	}
+	return &run.SelectorScraper{
+		Price:      run.Selector{CSS: scr.PriceSelector, Nth: scr.PriceNth, Regexp: scr.PriceRegexp},
+		Date:       run.Selector{CSS: scr.DateSelector, Nth: scr.DateNth, Regexp: scr.DateRegexp},
+		DateLayout: scr.DateLayout,
+		TimeZone:   scr.TimeZone,
+	}
+}
+
+// jsonScraper returns the definition of the json scraper,
+// or nil if not a json scraper.
+func (scr *configScraper) jsonScraper() *run.JSONScraper {
+	if scr.PricePath == "" && scr.DatePath == "" {
+		return nil
+	}
+	return &run.JSONScraper{
+		Price:      scr.PricePath,
+		Date:       scr.DatePath,
+		Currency:   scr.CurrencyPath,
+		DateLayout: scr.DateLayout,
+		TimeZone:   scr.TimeZone,
+	}
+}
+
+// hosts returns the hosts of the scraper pages.
+func (scr *configScraper) hosts() []string {
+	if len(scr.Hosts) == 0 {
+		return []string{scr.Name}
+	}
+	return scr.Hosts
+}
+
+func (scr *configScraper) retryPolicy() workers.RetryPolicy {
+	return workers.RetryPolicy{
+		MaxAttempts: scr.RetryAttempts,
+		Backoff:     scr.RetryBackoff.Duration,
+		MaxBackoff:  scr.RetryMaxBackoff.Duration,
+		Jitter:      scr.RetryJitter.Duration,
+	}
+}
+
+// configClient is the configuration of the http client of the scrapers.
+type configClient struct {
+	Timeout               duration
+	DialTimeout           duration
+	TLSHandshakeTimeout   duration
+	ResponseHeaderTimeout duration
+	MaxIdleConnsPerHost   int
+
+	UserAgent string
+	Headers   map[string]string
+
+	Proxy              string
+	CAFile             string
+	InsecureSkipVerify bool
+}
+
+// merge returns the client settings overridden by the not empty settings
+// of over. The headers are merged.
+func (c *configClient) merge(over *configClient) *configClient {
+	var m configClient
+	if c != nil {
+		m = *c
+	}
+	if over == nil {
+		return &m
+	}
+	if over.Timeout.Duration > 0 {
+		m.Timeout = over.Timeout
+	}
+	if over.DialTimeout.Duration > 0 {
+		m.DialTimeout = over.DialTimeout
+	}
+	if over.TLSHandshakeTimeout.Duration > 0 {
+		m.TLSHandshakeTimeout = over.TLSHandshakeTimeout
+	}
+	if over.ResponseHeaderTimeout.Duration > 0 {
+		m.ResponseHeaderTimeout = over.ResponseHeaderTimeout
+	}
+	if over.MaxIdleConnsPerHost > 0 {
+		m.MaxIdleConnsPerHost = over.MaxIdleConnsPerHost
+	}
+	if over.UserAgent != "" {
+		m.UserAgent = over.UserAgent
+	}
+	if len(over.Headers) > 0 {
+		m.Headers = map[string]string{}
+		for k, v := range c.headers() {
+			m.Headers[k] = v
+		}
+		for k, v := range over.Headers {
+			m.Headers[k] = v
+		}
+	}
+	if over.Proxy != "" {
+		m.Proxy = over.Proxy
+	}
+	if over.CAFile != "" {
+		m.CAFile = over.CAFile
+	}
+	if over.InsecureSkipVerify {
+		m.InsecureSkipVerify = true
+	}
+	return &m
+}
+
+func (c *configClient) headers() map[string]string {
+	if c == nil {
+		return nil
+	}
+	return c.Headers
+}
+
+// newClient returns the http client of the settings,
+// with the cache of the pages, if not nil.
+func (c *configClient) newClient(cache *run.Cache, ttl time.Duration) (*http.Client, error) {
+	if c == nil {
+		c = &configClient{}
+	}
+	return run.NewClient(run.ClientConfig{
+		Timeout:               c.Timeout.Duration,
+		DialTimeout:           c.DialTimeout.Duration,
+		TLSHandshakeTimeout:   c.TLSHandshakeTimeout.Duration,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout.Duration,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		UserAgent:             c.UserAgent,
+		Headers:               c.Headers,
+		Proxy:                 c.Proxy,
+		CAFile:                c.CAFile,
+		InsecureSkipVerify:    c.InsecureSkipVerify,
+		Cache:                 cache,
+		CacheTTL:              ttl,
+	})
 }
 
 type configStock struct {
@@ -56,10 +312,68 @@ type configStockSource struct {
 }
 
 type config struct {
+	// max duration of each stock, from its submission
+	StockTimeout duration
+
+	// max number of requests in flight, among all the scrapers
+	MaxInFlight int
+
+	// file with the state kept across the runs, e.g. the daily quotas
+	StateFile string
+
+	// http client shared by the scrapers
+	Client *configClient
+
+	// cache of the downloaded pages (disabled if not set), with the time
+	// the cached pages are used without asking the server
+	CacheDir string
+	CacheTTL duration
+
+	// hedging mode: the next source of a stock is tried only if the
+	// previous one hasn't answered within the delay, or the quantile
+	// of the observed latencies of the scraper
+	HedgeDelay    duration
+	HedgeQuantile float64
+
+	// consensus mode: the quote of a stock is the median price of the
+	// first sources answering, flagging the ones not within the tolerance
+	Consensus          int
+	ConsensusTolerance float64
+
 	Scrapers []*configScraper `toml:"scraper"`
 	Stocks   []*configStock   `toml:"stock"`
 }
 
+// cache returns the cache of the pages, or nil if not enabled
+// by the config or by the refresh and offline modes.
+func (cfg *config) cache(args *clArgs) (*run.Cache, error) {
+	if args.refresh && args.offline {
+		return nil, errors.New("Refresh and offline modes cannot be used together")
+	}
+	mode := run.CacheNormal
+	switch {
+	case args.refresh:
+		mode = run.CacheRefresh
+	case args.offline:
+		mode = run.CacheOffline
+	case cfg.CacheDir == "":
+		return nil, nil
+	}
+	dir := cfg.CacheDir
+	if dir == "" {
+		dir = defaultCacheDir
+	}
+	return run.NewCache(dir, mode)
+}
+
+// stateFile returns the path of the state file.
+func (cfg *config) stateFile() string {
+	if cfg.StateFile == "" {
+		return defaultStateFile
+	}
+	return cfg.StateFile
+}
+
 func (cfg *config) Print() {
 	for j, s := range cfg.Scrapers {
 		fmt.Printf("Scrapers[%d] %v\n", j, s)
@@ -119,9 +433,10 @@ func loadConfigFromFile(path string) (*config, error) {
 }
 
 func cmdHelp() {
-	fmt.Fprintln(os.Stderr, `Usage: getstocks [OPTION]...
+	fmt.Fprint(os.Stderr, `Usage: getstocks [OPTION]...
 
 getstocks retrives stocks quotes from web sites.
+
 `)
 }
 
@@ -134,6 +449,9 @@ func parseArgs() *clArgs {
 	flag.BoolVar(&args.debug, clDebug, false, "Debug mode. Do not cache templates and do not format generated code.")
 	flag.BoolVar(&args.help, clHelp, false, "Show command usage information.")
 	flag.BoolVar(&args.genConfig, clGenConfig, false, "Generate the configuration file instead of the package.")
+	flag.BoolVar(&args.verbose, clVerbose, false, "Verbose mode. Show the sources tried for each stock.")
+	flag.BoolVar(&args.refresh, clRefresh, false, "Refresh mode. Download all the pages again, updating the cache.")
+	flag.BoolVar(&args.offline, clOffline, false, "Offline mode. Get the pages from the cache only, without any download.")
 
 	flag.Parse()
 
@@ -153,9 +471,30 @@ func parseConfig(args *clArgs) (*config, error) {
 	return cfg, nil
 }
 
-func getRunArgs(cfg *config) ([]*run.Scraper, []*run.Stock, error) {
+// registerScrapers registers the declarative and json scrapers
+// of the config, replacing the builtin ones with the same name.
+func (cfg *config) registerScrapers() error {
+	for _, scr := range cfg.Scrapers {
+		sel, js := scr.selectorScraper(), scr.jsonScraper()
+		var err error
+		switch {
+		case sel != nil && js != nil:
+			err = fmt.Errorf("Invalid scraper: both selectors and json paths defined: %q", scr.Name)
+		case sel != nil:
+			err = run.RegisterSelectorScraper(scr.Name, scr.hosts(), sel)
+		case js != nil:
+			err = run.RegisterJSONScraper(scr.Name, scr.hosts(), js)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRunArgs(cfg *config, cache *run.Cache) ([]*run.Scraper, []*run.Stock, error) {
 	disabledScrapers := run.NewSet()
-	workers := map[string]int{}
+	enabledScrapers := map[string]*configScraper{}
 	//usedScrapers := map[string]*run.Scraper{}
 
 	stocks := make([]*run.Stock, 0, len(cfg.Stocks))
@@ -165,7 +504,7 @@ func getRunArgs(cfg *config) ([]*run.Scraper, []*run.Stock, error) {
 			disabledScrapers.Add(scr.Name)
 			continue
 		}
-		workers[scr.Name] = scr.Workers
+		enabledScrapers[scr.Name] = scr
 	}
 
 	// Builds the stock array skipping only the esplicitly disabled stocks.
@@ -233,21 +572,72 @@ func getRunArgs(cfg *config) ([]*run.Scraper, []*run.Stock, error) {
 	}
 
 	// build scrapers array (only)
-	scrapers := make([]*run.Scraper, 0, len(workers))
-	for name, workers := range workers {
+	var quotas *run.QuotaStore
+	scrapers := make([]*run.Scraper, 0, len(enabledScrapers))
+	for name, scr := range enabledScrapers {
+		// scrapers with their own client settings,
+		// the others share run.DefaultClient and its connections
+		var client *http.Client
+		if scr.Client != nil {
+			var err error
+			if client, err = cfg.Client.merge(scr.Client).newClient(cache, cfg.CacheTTL.Duration); err != nil {
+				return nil, nil, fmt.Errorf("%s: scraper=%q", err, name)
+			}
+		}
+		var quota run.Quota
+		if scr.DailyQuota > 0 {
+			if quotas == nil {
+				var err error
+				if quotas, err = run.LoadQuotaStore(cfg.stateFile()); err != nil {
+					return nil, nil, err
+				}
+			}
+			quota = quotas.Quota(name, scr.DailyQuota)
+		}
 		scrapers = append(scrapers, &run.Scraper{
-			Name:    name,
-			Workers: workers,
+			Name:      name,
+			Workers:   scr.Workers,
+			RateLimit: scr.rateLimit(),
+			Retry:     scr.retryPolicy(),
+			Timeout:   scr.Timeout.Duration,
+			Breaker:   scr.circuitBreaker(),
+			Scaling:   scr.scaling(),
+			Quota:     quota,
+			Client:    client,
+			CacheTTL:  scr.CacheTTL.Duration,
+			BatchURL:  scr.BatchURL,
 		})
 	}
 
 	return scrapers, stocks, nil
 }
 
-func doJob(scrapers []*run.Scraper, stocks []*run.Stock) error {
+// runOptions returns the dispatcher options from the config.
+func (cfg *config) runOptions() []workers.Option {
+	opts := []workers.Option{
+		workers.JobTimeout(cfg.StockTimeout.Duration),
+		workers.MaxInFlight(cfg.MaxInFlight),
+	}
+	if cfg.HedgeDelay.Duration > 0 || cfg.HedgeQuantile > 0 {
+		opts = append(opts, workers.Hedge(workers.HedgePolicy{
+			Delay:    cfg.HedgeDelay.Duration,
+			Quantile: cfg.HedgeQuantile,
+		}))
+	}
+	if cfg.Consensus > 1 {
+		opts = append(opts, run.Consensus(cfg.Consensus, cfg.ConsensusTolerance))
+	}
+	return opts
+}
+
+func doJob(scrapers []*run.Scraper, stocks []*run.Stock, opts []workers.Option, verbose bool) error {
 
 	ctx := context.Background()
-	out, err := run.Execute(ctx, scrapers, stocks)
+	execute := run.Execute
+	if verbose {
+		execute = run.ExecuteVerbose
+	}
+	out, err := execute(ctx, scrapers, stocks, opts...)
 
 	if err != nil {
 		return err
@@ -267,6 +657,16 @@ func doJob(scrapers []*run.Scraper, stocks []*run.Stock) error {
 			sDate = r.Result.Date.Format("02-01-2006")
 		}
 		fmt.Printf("%-20s %10s  %15s  (%s) %v\n", r.StockName, sPrice, sDate, r.ScraperName, r.Err)
+		for _, d := range r.Disagreeing {
+			fmt.Printf("%-20s %10.3f  %15s  (%s) disagrees\n", "", d.Result.Price, d.Result.Date.Format("02-01-2006"), d.ScraperName)
+		}
+		for _, a := range r.Attempts {
+			fmt.Printf("%-20s   - (%s) %s", "", a.ScraperName, a.Outcome)
+			if a.Outcome == workers.Failed || a.Outcome == workers.Cancelled {
+				fmt.Printf(": %v", a.Err)
+			}
+			fmt.Println()
+		}
 	}
 	return nil
 }
@@ -295,7 +695,22 @@ func Run() int {
 	}
 	cfg.Print()
 
-	scrapers, stocks, err := getRunArgs(cfg)
+	if err := cfg.registerScrapers(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	cache, err := cfg.cache(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if run.DefaultClient, err = cfg.Client.newClient(cache, cfg.CacheTTL.Duration); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	scrapers, stocks, err := getRunArgs(cfg, cache)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		return 2
@@ -312,7 +727,7 @@ func Run() int {
 	//fmt.Printf("    - %s\n", src.URL)
 	//}
 	//}
-	err = doJob(scrapers, stocks)
+	err = doJob(scrapers, stocks, cfg.runOptions(), args.verbose)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		return 1
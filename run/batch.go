@@ -0,0 +1,42 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrNotInBatch is the error of a stock not found in the page of a batch scraper.
+var ErrNotInBatch = errors.New("Stock not in the batch page")
+
+// BatchParseFunc parses a page with the quotes of many stocks,
+// returning the results by ISIN.
+type BatchParseFunc func(doc *goquery.Document) (map[string]*Result, error)
+
+// batchPage is the parsed page of a batch scraper.
+type batchPage struct {
+	results map[string]*Result // by ISIN
+}
+
+// scrapeBatch gets the url and parses the page with the batch scraper.
+func scrapeBatch(ctx context.Context, client *http.Client, scraperName, url string) (*batchPage, error) {
+	doc, err := getDoc(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	results, err := getParseBatchFunc(scraperName)(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &batchPage{results: results}, nil
+}
+
+// result returns the result of the stock with the isin.
+func (page *batchPage) result(isin string) (*Result, error) {
+	if res := page.results[isin]; res != nil {
+		return res, nil
+	}
+	return nil, ErrNotInBatch
+}
@@ -0,0 +1,159 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmbros/getstocks/workers"
+)
+
+func init() {
+	RegisterBatchScraper("test.batch", parseTestBatch)
+}
+
+// parseTestBatch parses the rows "isin price" of the test page.
+func parseTestBatch(doc *goquery.Document) (map[string]*Result, error) {
+	results := map[string]*Result{}
+	doc.Find("tr").Each(func(i int, s *goquery.Selection) {
+		td := s.Find("td")
+		res := &Result{PriceStr: td.Eq(1).Text()}
+		res.Price, _ = parsePrice(res.PriceStr)
+		results[td.Eq(0).Text()] = res
+	})
+	return results, nil
+}
+
+func TestBatchScraper(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprint(w, "<table><tr><td>IT0001</td><td>10,5</td></tr><tr><td>IT0002</td><td>20</td></tr></table>")
+	}))
+	defer srv.Close()
+
+	scrapers := []*Scraper{{Name: "test.batch", Workers: 2, BatchURL: srv.URL}}
+	stocks := []*Stock{
+		{Name: "stock_1", Isin: "IT0001"},
+		{Name: "stock_2", Isin: "IT0002"},
+		{Name: "stock_3", Isin: "IT0003"},
+	}
+	out, err := Execute(context.Background(), scrapers, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices := map[string]float32{}
+	for res := range out {
+		switch {
+		case res.StockName == "stock_3":
+			if res.Err != ErrNotInBatch {
+				t.Errorf("stock_3: expected %v, found %v", ErrNotInBatch, res.Err)
+			}
+		case res.Err != nil:
+			t.Errorf("%s: unexpected error %v", res.StockName, res.Err)
+		default:
+			prices[res.StockName] = res.Result.Price
+		}
+	}
+	if prices["stock_1"] != 10.5 || prices["stock_2"] != 20 {
+		t.Errorf("expected prices 10.5 and 20, found %v", prices)
+	}
+	if hits != 1 {
+		t.Errorf("expected 1 download of the page, found %d", hits)
+	}
+}
+
+func TestBatchScraperFallback(t *testing.T) {
+	batch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<table><tr><td>IT0001</td><td>10,5</td></tr></table>")
+	}))
+	defer batch.Close()
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<span id="price">12,34</span><span id="date">01/02/2017</span>`)
+	}))
+	defer page.Close()
+
+	// the stock missing from the batch page gets the price of its own source
+	scrapers := []*Scraper{
+		{Name: "test.batch", Workers: 1, BatchURL: batch.URL},
+		{Name: "test.scraper", Workers: 1},
+	}
+	stocks := []*Stock{{Name: "stock_1", Isin: "IT0003", Sources: []*StockSource{{Scraper: "test.scraper", URL: page.URL}}}}
+	out, err := Execute(context.Background(), scrapers, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for res := range out {
+		if res.Err != nil || res.ScraperName != "test.scraper" || res.Result.Price != 12.34 {
+			t.Errorf("expected price 12.34 of test.scraper, found %s %v %v", res.ScraperName, res.Result, res.Err)
+		}
+	}
+}
+
+func TestBatchScraperRetry(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<table><tr><td>IT0001</td><td>10,5</td></tr><tr><td>IT0002</td><td>20</td></tr></table>")
+	}))
+	defer srv.Close()
+
+	// the failed download is not shared: the retry downloads the page again
+	scrapers := []*Scraper{{Name: "test.batch", Workers: 1, BatchURL: srv.URL, Retry: workers.RetryPolicy{MaxAttempts: 2}}}
+	stocks := []*Stock{{Name: "stock_1", Isin: "IT0001"}, {Name: "stock_2", Isin: "IT0002"}}
+	out, err := Execute(context.Background(), scrapers, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for res := range out {
+		if res.Err != nil {
+			t.Errorf("%s: unexpected error %v", res.StockName, res.Err)
+		}
+	}
+	if hits != 2 {
+		t.Errorf("expected 2 downloads of the page, found %d", hits)
+	}
+}
+
+func TestBatchScraperBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<table><tr><td>IT0001</td><td>10,5</td></tr></table>")
+	}))
+	defer srv.Close()
+
+	// the stocks missing from the page don't open the circuit
+	scrapers := []*Scraper{{
+		Name:     "test.batch",
+		Workers:  1,
+		BatchURL: srv.URL,
+		Breaker:  workers.CircuitBreaker{ConsecutiveFailures: 1},
+	}}
+	stocks := []*Stock{
+		{Name: "stock_1", Isin: "IT0001"},
+		{Name: "stock_2", Isin: "IT0002"},
+		{Name: "stock_3", Isin: "IT0003"},
+	}
+	out, err := Execute(context.Background(), scrapers, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for res := range out {
+		if res.StockName != "stock_1" && res.Err != ErrNotInBatch {
+			t.Errorf("%s: expected %v, found %v", res.StockName, ErrNotInBatch, res.Err)
+		}
+	}
+}
+
+func TestBatchScraperNotFound(t *testing.T) {
+	scrapers := []*Scraper{{Name: "test.unknown", BatchURL: "http://localhost/"}}
+	if _, _, err := workersArgs(scrapers, nil); err == nil {
+		t.Error("expected error for unknown batch scraper")
+	}
+}
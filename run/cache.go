@@ -0,0 +1,212 @@
+package run
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CacheMode is the way the cached pages are used.
+type CacheMode int
+
+const (
+	// CacheNormal uses the cached pages within their TTL,
+	// and revalidates the older ones with the server.
+	CacheNormal CacheMode = iota
+	// CacheRefresh downloads the pages again, updating the cache.
+	CacheRefresh
+	// CacheOffline uses the cached pages only, whatever their age,
+	// without any request to the servers.
+	CacheOffline
+)
+
+// ErrNotCached is the error of a page not in the cache, in offline mode.
+var ErrNotCached = errors.New("Page not cached")
+
+// Cache keeps the pages downloaded with status 200 in a directory,
+// by URL. The pages are revalidated by their ETag and Last-Modified headers.
+type Cache struct {
+	dir  string
+	mode CacheMode
+	now  func() time.Time
+}
+
+// cacheEntry is the metadata of a cached page.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	Time         time.Time `json:"time"` // last download or revalidation
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+}
+
+// NewCache returns the cache of the directory, creating it if needed.
+func NewCache(dir string, mode CacheMode) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, mode: mode, now: time.Now}, nil
+}
+
+// Transport returns the round tripper getting the pages from the cache,
+// if not older than ttl, and from base otherwise.
+// The CacheTTL of the scraper of the request, if any, overrides ttl.
+func (c *Cache) Transport(base http.RoundTripper, ttl time.Duration) http.RoundTripper {
+	return &cacheTransport{cache: c, base: base, ttl: ttl}
+}
+
+type cacheTransport struct {
+	cache *Cache
+	base  http.RoundTripper
+	ttl   time.Duration
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	c := t.cache
+	url := req.URL.String()
+	entry, body := c.load(url)
+	ttl := t.ttl
+	if fs := fetchSettingsOf(req.Context()); fs != nil && fs.cacheTTL > 0 {
+		ttl = fs.cacheTTL
+	}
+
+	switch {
+	case c.mode == CacheOffline:
+		if entry == nil {
+			return nil, ErrNotCached
+		}
+		return entry.response(req, body), nil
+	case c.mode == CacheRefresh:
+		entry = nil
+	case entry != nil && c.now().Sub(entry.Time) < ttl:
+		return entry.response(req, body), nil
+	}
+
+	// download the page, or revalidate the cached one
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		resp.Body.Close()
+		entry.Time = c.now()
+		c.store(entry, nil)
+		return entry.response(req, body), nil
+	case resp.StatusCode != http.StatusOK:
+		return resp, nil
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry = &cacheEntry{
+		URL:          url,
+		Time:         c.now(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+	}
+	c.store(entry, body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// response returns the cached page as the response of the request.
+func (e *cacheEntry) response(req *http.Request, body []byte) *http.Response {
+	header := http.Header{}
+	if e.ContentType != "" {
+		header.Set("Content-Type", e.ContentType)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// path returns the path of the files of the url, without extension.
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// load returns the cached page of the url, or nil if not cached.
+func (c *Cache) load(url string) (*cacheEntry, []byte) {
+	p := c.path(url)
+	meta, err := os.ReadFile(p + ".json")
+	if err != nil {
+		return nil, nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(meta, &entry); err != nil || entry.URL != url {
+		return nil, nil
+	}
+	body, err := os.ReadFile(p + ".body")
+	if err != nil {
+		return nil, nil
+	}
+	return &entry, body
+}
+
+// store saves the page in the cache, or only its metadata if body is nil.
+// The metadata is written last, so that a page is never half stored.
+// An error saving the page is ignored: the page is just not cached.
+func (c *Cache) store(entry *cacheEntry, body []byte) {
+	p := c.path(entry.URL)
+	if body != nil {
+		if err := writeFile(p+".body", body); err != nil {
+			return
+		}
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	writeFile(p+".json", meta)
+}
+
+// writeFile writes the file, replacing it at once.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,159 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmbros/getstocks/workers"
+)
+
+func TestCache(t *testing.T) {
+	var hits, revalidated int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&revalidated, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "page")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	now := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	get := func(mode CacheMode, url string) (string, error) {
+		t.Helper()
+		cache, err := NewCache(dir, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache.now = func() time.Time { return now }
+		client, err := NewClient(ClientConfig{Cache: cache, CacheTTL: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := getPage(context.Background(), client, url)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+	expect := func(mode CacheMode, expHits, expRevalidated int32) {
+		t.Helper()
+		if body, err := get(mode, srv.URL); body != "page" || err != nil {
+			t.Errorf("expected page, found %q (%v)", body, err)
+		}
+		if hits != expHits || revalidated != expRevalidated {
+			t.Errorf("expected %d hits and %d revalidated, found %d and %d", expHits, expRevalidated, hits, revalidated)
+		}
+	}
+
+	// downloaded, then cached within the ttl
+	expect(CacheNormal, 1, 0)
+	expect(CacheNormal, 1, 0)
+	// revalidated after the ttl
+	now = now.Add(2 * time.Hour)
+	expect(CacheNormal, 2, 1)
+	expect(CacheNormal, 2, 1)
+	// downloaded again
+	expect(CacheRefresh, 3, 1)
+
+	// offline: no request to the server
+	now = now.Add(24 * time.Hour)
+	expect(CacheOffline, 3, 1)
+	if _, err := get(CacheOffline, srv.URL+"/other"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("expected %v, found %v", ErrNotCached, err)
+	}
+}
+
+func TestCacheScraperTTL(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		io.WriteString(w, "page")
+	}))
+	defer srv.Close()
+
+	cache, err := NewCache(t.TempDir(), CacheNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	// one client for all the scrapers
+	client, err := NewClient(ClientConfig{Cache: cache, CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(ttl time.Duration) {
+		t.Helper()
+		ctx := withFetchSettings(context.Background(), &fetchSettings{cacheTTL: ttl})
+		resp, err := getPage(ctx, client, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	get(0)
+	now = now.Add(2 * time.Hour)
+	// cached for the scraper with the longer ttl
+	get(3 * time.Hour)
+	if hits != 1 {
+		t.Errorf("expected 1 hit, found %d", hits)
+	}
+	// downloaded again with the ttl of the client
+	get(0)
+	if hits != 2 {
+		t.Errorf("expected 2 hits, found %d", hits)
+	}
+}
+
+// countTransport counts the requests of the client.
+type countTransport struct {
+	base  http.RoundTripper
+	count int32
+}
+
+func (t *countTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return t.base.RoundTrip(req)
+}
+
+func TestCacheOfflineRetry(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), CacheOffline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &countTransport{base: cache.Transport(http.DefaultTransport, 0)}
+	scrapers := []*Scraper{{
+		Name:    "test.scraper",
+		Workers: 1,
+		Retry:   workers.RetryPolicy{MaxAttempts: 3},
+		Client:  &http.Client{Transport: tr},
+	}}
+	stocks := []*Stock{{Name: "stock_1", Sources: []*StockSource{{Scraper: "test.scraper", URL: "http://quotes.test/"}}}}
+	out, err := Execute(context.Background(), scrapers, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for res := range out {
+		if !errors.Is(res.Err, ErrNotCached) {
+			t.Errorf("expected %v, found %v", ErrNotCached, res.Err)
+		}
+	}
+	// the pages not cached are not retried
+	if tr.count != 1 {
+		t.Errorf("expected 1 request, found %d", tr.count)
+	}
+}
@@ -0,0 +1,187 @@
+package run
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"time"
+
+	"github.com/mmbros/getstocks/workers"
+)
+
+// default User-Agent header of the requests
+const defaultUserAgent = "getstocks"
+
+// ClientConfig is the configuration of an HTTP client of the scrapers.
+// The zero value is a client with the default settings of net/http,
+// sending the "getstocks" User-Agent.
+type ClientConfig struct {
+	// Timeout is the max duration of a request, body included.
+	// Zero means no timeout.
+	Timeout time.Duration
+	// DialTimeout is the max duration of a connection. Zero means 30s.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout is the max duration of the TLS handshake.
+	// Zero means 10s.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout is the max duration waiting for the response
+	// headers, once the request is sent. Zero means no timeout.
+	ResponseHeaderTimeout time.Duration
+	// MaxIdleConnsPerHost is the max number of keep-alive connections
+	// of each host. Zero means 2.
+	MaxIdleConnsPerHost int
+
+	// UserAgent is the User-Agent header. Empty means "getstocks".
+	UserAgent string
+	// Headers are the headers added to each request.
+	Headers map[string]string
+
+	// Proxy is the URL of the proxy.
+	// Empty means the proxy of the environment, if any.
+	Proxy string
+	// CAFile is the PEM file of the certificates of the trusted CAs,
+	// in addition to the ones of the system.
+	CAFile string
+	// InsecureSkipVerify disables the verification of the certificates.
+	InsecureSkipVerify bool
+
+	// Cache, if not nil, keeps the downloaded pages on disk.
+	Cache *Cache
+	// CacheTTL is the age of the cached pages after which
+	// they are revalidated with the server, unless the scraper
+	// of the request has its own CacheTTL.
+	CacheTTL time.Duration
+}
+
+// DefaultClient is the HTTP client of the scrapers without their own Client.
+// Its connections are kept alive and shared by all the requests.
+var DefaultClient = newDefaultClient()
+
+func newDefaultClient() *http.Client {
+	c, err := NewClient(ClientConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewClient returns the HTTP client of the configuration.
+func NewClient(cfg ClientConfig) (*http.Client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if cfg.DialTimeout > 0 {
+		dialer.Timeout = cfg.DialTimeout
+	}
+	tr.DialContext = dialer.DialContext
+	if cfg.TLSHandshakeTimeout > 0 {
+		tr.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	tr.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	if cfg.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+
+	if cfg.Proxy != "" {
+		u, err := neturl.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proxy %q: %s", cfg.Proxy, err)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	if cfg.CAFile != "" || cfg.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("No certificates found in %q", cfg.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		tr.TLSClientConfig = tlsConfig
+	}
+
+	headers := http.Header{}
+	for k, v := range cfg.Headers {
+		headers.Set(k, v)
+	}
+	if headers.Get("User-Agent") == "" {
+		ua := cfg.UserAgent
+		if ua == "" {
+			ua = defaultUserAgent
+		}
+		headers.Set("User-Agent", ua)
+	}
+
+	// the quota is taken by the downloads only, below the cache
+	var base http.RoundTripper = &quotaTransport{base: tr}
+	if cfg.Cache != nil {
+		base = cfg.Cache.Transport(base, cfg.CacheTTL)
+	}
+	return &http.Client{
+		Transport: &headerTransport{base: base, headers: headers},
+		Timeout:   cfg.Timeout,
+	}, nil
+}
+
+// headerTransport adds the headers to the requests,
+// unless already set.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = v
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// quotaTransport takes the requests from the quota of their scraper, if any.
+type quotaTransport struct {
+	base http.RoundTripper
+}
+
+func (t *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if fs := fetchSettingsOf(req.Context()); fs != nil && fs.quota != nil && !fs.quota.Take() {
+		return nil, workers.ErrQuotaExhausted
+	}
+	return t.base.RoundTrip(req)
+}
+
+// fetchSettings are the settings of the downloads of a scraper.
+// They are passed to the transports of NewClient by the request context.
+type fetchSettings struct {
+	client   *http.Client // nil means DefaultClient
+	cacheTTL time.Duration
+	quota    Quota
+}
+
+type fetchSettingsKey struct{}
+
+func withFetchSettings(ctx context.Context, fs *fetchSettings) context.Context {
+	return context.WithValue(ctx, fetchSettingsKey{}, fs)
+}
+
+// fetchSettingsOf returns the settings of the request context, or nil.
+func fetchSettingsOf(ctx context.Context) *fetchSettings {
+	fs, _ := ctx.Value(fetchSettingsKey{}).(*fetchSettings)
+	return fs
+}
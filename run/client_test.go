@@ -0,0 +1,105 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientHeaders(t *testing.T) {
+	var ua, lang atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua.Store(r.Header.Get("User-Agent"))
+		lang.Store(r.Header.Get("Accept-Language"))
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		cfg  ClientConfig
+		ua   string
+		lang string
+	}{
+		{ClientConfig{}, "getstocks", ""},
+		{ClientConfig{UserAgent: "agent", Headers: map[string]string{"Accept-Language": "it"}}, "agent", "it"},
+		{ClientConfig{UserAgent: "agent", Headers: map[string]string{"User-Agent": "header"}}, "header", ""},
+	}
+	for _, tc := range testCases {
+		client, err := NewClient(tc.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := getUrl(context.Background(), client, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if ua.Load() != tc.ua || lang.Load() != tc.lang {
+			t.Errorf("expected %q %q, found %q %q", tc.ua, tc.lang, ua.Load(), lang.Load())
+		}
+	}
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html></html>")
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	client, err := NewClient(ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := 0; j < 3; j++ {
+		if _, err := getDoc(context.Background(), client, srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conns != 1 {
+		t.Errorf("expected 1 connection, found %d", conns)
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := getUrl(ctx, DefaultClient, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, found %v", context.DeadlineExceeded, err)
+	}
+
+	// client timeout
+	client, err := NewClient(ClientConfig{Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getUrl(context.Background(), client, srv.URL); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestNewClientErrors(t *testing.T) {
+	for _, cfg := range []ClientConfig{{Proxy: "://"}, {CAFile: "missing.pem"}} {
+		if _, err := NewClient(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// coalescer shares the download of a page among the requests of a run
+// with the same scraper and URL: the concurrent requests wait for the
+// same download, and the later ones get its result if successful.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// call is a download in progress or completed.
+type call struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int // requests waiting for the download
+
+	val interface{}
+	err error
+}
+
+// panicError is the error of a fetch function that panicked.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string { return fmt.Sprintf("Panic: %v", e.value) }
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: map[string]*call{}}
+}
+
+// do returns the value of fetch for the key, calling it only if there isn't
+// a download of the key in progress or successfully completed.
+// The download is cancelled once all the requests waiting for it are done.
+func (c *coalescer) do(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	cl := c.calls[key]
+	if cl == nil {
+		// the download doesn't depend on the context of a single request
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cl = &call{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = cl
+		go func() {
+			defer func() {
+				// a panic of fetch fails the requests waiting for it
+				if v := recover(); v != nil {
+					cl.val, cl.err = nil, &panicError{value: v, stack: debug.Stack()}
+				}
+				cancel()
+				if cl.err != nil {
+					// failed downloads are not shared with the later requests
+					c.forget(key, cl)
+				}
+				close(cl.done)
+			}()
+			cl.val, cl.err = fetch(fctx)
+		}()
+	}
+	cl.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.val, cl.err
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	cl.waiters--
+	if cl.waiters == 0 {
+		select {
+		case <-cl.done:
+		default:
+			cl.cancel()
+			delete(c.calls, key)
+		}
+	}
+	c.mu.Unlock()
+	return nil, ctx.Err()
+}
+
+// forget removes the call of the key, if not already replaced.
+func (c *coalescer) forget(key string, cl *call) {
+	c.mu.Lock()
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,157 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmbros/getstocks/workers"
+)
+
+func init() {
+	RegisterScraper("test.panic", nil, func(doc *goquery.Document) (*Result, error) {
+		panic("parser bug")
+	})
+}
+
+// waitWaiters waits until n requests are waiting for the download of the key.
+func waitWaiters(c *coalescer, key string, n int) {
+	for {
+		c.mu.Lock()
+		cl := c.calls[key]
+		ok := cl != nil && cl.waiters == n
+		c.mu.Unlock()
+		if ok {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestCoalescerShare(t *testing.T) {
+	c := newCoalescer()
+	var calls int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &Result{Price: 10}, nil
+	}
+
+	// concurrent requests share the same download
+	var wg sync.WaitGroup
+	for j := 0; j < 5; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := c.do(context.Background(), "key", fetch)
+			if err != nil || res.(*Result).Price != 10 {
+				t.Errorf("expected price 10, found %v %v", res, err)
+			}
+		}()
+	}
+	waitWaiters(c, "key", 5)
+	close(release)
+	wg.Wait()
+
+	// later requests get the result of the completed download
+	if _, err := c.do(context.Background(), "key", fetch); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 download, found %d", calls)
+	}
+}
+
+func TestCoalescerError(t *testing.T) {
+	c := newCoalescer()
+	var calls int32
+	fetch := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("ERR")
+	}
+
+	// failed downloads are retried by the later requests
+	for j := 0; j < 2; j++ {
+		if _, err := c.do(context.Background(), "key", fetch); err == nil {
+			t.Error("expected error")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 downloads, found %d", calls)
+	}
+}
+
+func TestCoalescerCancel(t *testing.T) {
+	c := newCoalescer()
+	fetchCtx := make(chan context.Context, 1)
+	fetch := func(ctx context.Context) (interface{}, error) {
+		fetchCtx <- ctx
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { _, err := c.do(ctx1, "key", fetch); errs <- err }()
+	go func() { _, err := c.do(ctx2, "key", fetch); errs <- err }()
+	waitWaiters(c, "key", 2)
+	fctx := <-fetchCtx
+
+	// the download goes on while a request is waiting for it
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected %v, found %v", context.Canceled, err)
+	}
+	if fctx.Err() != nil {
+		t.Fatal("download cancelled with a request waiting")
+	}
+
+	// the download is cancelled with the last request
+	cancel2()
+	<-errs
+	<-fctx.Done()
+}
+
+func TestCoalescerPanic(t *testing.T) {
+	c := newCoalescer()
+	fetch := func(ctx context.Context) (interface{}, error) {
+		panic("fetch bug")
+	}
+	_, err := c.do(context.Background(), "key", fetch)
+	if perr, ok := err.(*panicError); !ok || perr.value != "fetch bug" || len(perr.stack) == 0 {
+		t.Errorf("expected panicError, found %v", err)
+	}
+}
+
+func TestExecutePanicShared(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the stocks share the download of the panicking scraper
+	stocks := []*Stock{
+		{Name: "stock_1", Sources: []*StockSource{{Scraper: "test.panic", URL: srv.URL}}},
+		{Name: "stock_2", Sources: []*StockSource{{Scraper: "test.panic", URL: srv.URL}}},
+	}
+	out, err := Execute(context.Background(), []*Scraper{{Name: "test.panic", Workers: 2}}, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for res := range out {
+		n++
+		if _, ok := res.Err.(*workers.PanicError); !ok {
+			t.Errorf("%s: expected PanicError, found %v", res.StockName, res.Err)
+		}
+	}
+	if n != 2 {
+		t.Errorf("expected 2 responses, found %d", n)
+	}
+}
@@ -0,0 +1,52 @@
+package run
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mmbros/getstocks/workers"
+)
+
+// Consensus returns the option of the consensus mode:
+// the quote of each stock is the median price of up to n success responses
+// from its sources. The sources whose price differs from the consensus price
+// more than tolerance (e.g. 0.005 for 0.5%) are reported as disagreeing.
+func Consensus(n int, tolerance float64) workers.Option {
+	return workers.Quorum(n, consensusReducer(tolerance))
+}
+
+func consensusReducer(tolerance float64) workers.Reducer {
+	return func(job workers.JobKey, wres []workers.Response) workers.Response {
+		return consensus(wres, tolerance)
+	}
+}
+
+// consensus returns a copy of the response with the median price,
+// with the lower one in case of an even number of responses.
+func consensus(wres []workers.Response, tolerance float64) *Response {
+	sources := make([]*Response, 0, len(wres))
+	for _, w := range wres {
+		sources = append(sources, w.(*Response))
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Result.Price < sources[j].Result.Price
+	})
+
+	median := sources[(len(sources)-1)/2]
+	res := *median
+	res.Sources = sources
+	for _, src := range sources {
+		if !agree(src.Result.Price, median.Result.Price, tolerance) {
+			res.Disagreeing = append(res.Disagreeing, src)
+		}
+	}
+	return &res
+}
+
+// agree reports whether the price is within the tolerance of the reference price.
+func agree(price, ref float32, tolerance float64) bool {
+	if ref == 0 {
+		return price == 0
+	}
+	return math.Abs(float64(price-ref)/float64(ref)) <= tolerance
+}
@@ -0,0 +1,65 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/mmbros/getstocks/workers"
+)
+
+func TestConsensus(t *testing.T) {
+	newres := func(scraper string, price float32) workers.Response {
+		return &Response{
+			ScraperName: scraper,
+			StockName:   "stock",
+			Result:      &Result{Price: price},
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		responses []workers.Response
+		scraper   string
+		price     float32
+		disagree  []string
+	}{
+		{
+			"single",
+			[]workers.Response{newres("a", 10)},
+			"a", 10, nil,
+		},
+		{
+			"all agree",
+			[]workers.Response{newres("a", 10.02), newres("b", 10), newres("c", 10.01)},
+			"c", 10.01, nil,
+		},
+		{
+			"one disagrees",
+			[]workers.Response{newres("a", 10), newres("b", 11), newres("c", 10.01)},
+			"c", 10.01, []string{"b"},
+		},
+		{
+			"even",
+			[]workers.Response{newres("a", 11), newres("b", 10)},
+			"b", 10, []string{"a"},
+		},
+	}
+
+	for _, tc := range testCases {
+		res := consensus(tc.responses, 0.005)
+		if res.ScraperName != tc.scraper || res.Result.Price != tc.price {
+			t.Errorf("[%s] expected %s %v, found %s %v", tc.name, tc.scraper, tc.price, res.ScraperName, res.Result.Price)
+		}
+		if len(res.Sources) != len(tc.responses) {
+			t.Errorf("[%s] sources: expected %d, found %d", tc.name, len(tc.responses), len(res.Sources))
+		}
+		if len(res.Disagreeing) != len(tc.disagree) {
+			t.Errorf("[%s] disagreeing: expected %v, found %d", tc.name, tc.disagree, len(res.Disagreeing))
+			continue
+		}
+		for j, d := range res.Disagreeing {
+			if d.ScraperName != tc.disagree[j] {
+				t.Errorf("[%s] disagreeing: expected %v, found %s", tc.name, tc.disagree, d.ScraperName)
+			}
+		}
+	}
+}
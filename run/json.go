@@ -0,0 +1,227 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONParseFunc parses the decoded JSON of a stock page,
+// with the numbers as json.Number.
+type JSONParseFunc func(v interface{}) (*Result, error)
+
+// JSONScraper is a scraper of a JSON API, defined by the path expressions
+// of the price, the date and the currency of the stock.
+// A path is a JSONPath-like expression, e.g. "$.data.quotes[0].last":
+// the keys of the objects are separated by dots or given as ['key'],
+// the indexes of the arrays are given as [n], negative from the end.
+type JSONScraper struct {
+	Price string
+	Date  string
+	// Currency is optional.
+	Currency string
+	// DateLayout is the layout of the date, as in time.Parse,
+	// or "unix" or "unixms" for the seconds or milliseconds since the epoch.
+	DateLayout string
+	// TimeZone is the location of the date, e.g. "Europe/Rome".
+	// Empty means "Europe/Rome".
+	TimeZone string
+}
+
+// jsonStep is a step of a path: an object key or an array index.
+type jsonStep struct {
+	key   string
+	index int
+	isKey bool
+}
+
+type jsonPath []jsonStep
+
+// compileJSONPath parses the path expression.
+func compileJSONPath(expr string) (jsonPath, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	var path jsonPath
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "['"):
+			end := strings.Index(s, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path %q: missing ']", expr)
+			}
+			path = append(path, jsonStep{key: s[2:end], isKey: true})
+			s = s[end+2:]
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path %q: missing ]", expr)
+			}
+			n, err := strconv.Atoi(s[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid path %q: index %q", expr, s[1:end])
+			}
+			path = append(path, jsonStep{index: n})
+			s = s[end+1:]
+		case s[0] == '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("Invalid path %q: empty key", expr)
+			}
+			path = append(path, jsonStep{key: s[:end], isKey: true})
+			s = s[end:]
+		default:
+			if len(path) > 0 {
+				return nil, fmt.Errorf("Invalid path %q", expr)
+			}
+			// leading key without the dot, e.g. "data.price"
+			s = "." + s
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("Invalid path %q: empty", expr)
+	}
+	return path, nil
+}
+
+// eval returns the value of the path, and whether it was found.
+func (path jsonPath) eval(v interface{}) (interface{}, bool) {
+	for _, step := range path {
+		if step.isKey {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[step.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		j := step.index
+		if j < 0 {
+			j += len(arr)
+		}
+		if j < 0 || j >= len(arr) {
+			return nil, false
+		}
+		v = arr[j]
+	}
+	return v, true
+}
+
+// text returns the value of the path as a string,
+// or the empty string if not found or not a scalar.
+func (path jsonPath) text(v interface{}) string {
+	v, ok := path.eval(v)
+	if !ok {
+		return ""
+	}
+	switch x := v.(type) {
+	case string:
+		return strings.TrimSpace(x)
+	case json.Number:
+		return x.String()
+	}
+	return ""
+}
+
+// Compile checks the scraper definition and returns its parse function.
+func (s *JSONScraper) Compile() (JSONParseFunc, error) {
+	price, err := compileJSONPath(s.Price)
+	if err != nil {
+		return nil, fmt.Errorf("Price: %s", err)
+	}
+	date, err := compileJSONPath(s.Date)
+	if err != nil {
+		return nil, fmt.Errorf("Date: %s", err)
+	}
+	var currency jsonPath
+	if s.Currency != "" {
+		if currency, err = compileJSONPath(s.Currency); err != nil {
+			return nil, fmt.Errorf("Currency: %s", err)
+		}
+	}
+	if s.DateLayout == "" {
+		return nil, errors.New("Date layout cannot be empty")
+	}
+	tz := s.TimeZone
+	if tz == "" {
+		tz = defaultTimeZone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := s.DateLayout
+	return func(v interface{}) (*Result, error) {
+		res := &Result{
+			PriceStr: price.text(v),
+			DateStr:  date.text(v),
+		}
+		if currency != nil {
+			res.Currency = currency.text(v)
+		}
+		var err error
+		if res.Price, err = parsePrice(res.PriceStr); err != nil {
+			return nil, err
+		}
+		if res.Date, err = parseJSONDate(layout, res.DateStr, loc); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}, nil
+}
+
+// parseJSONDate parses the date with the layout,
+// or as the seconds or milliseconds since the epoch.
+func parseJSONDate(layout, str string, loc *time.Location) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, errors.New("Date not found")
+	}
+	switch layout {
+	case "unix", "unixms":
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == "unixms" {
+			return time.UnixMilli(n).In(loc), nil
+		}
+		return time.Unix(n, 0).In(loc), nil
+	}
+	return time.ParseInLocation(layout, str, loc)
+}
+
+// decodeJSON decodes the JSON of the reader, with the numbers as json.Number.
+func decodeJSON(r io.Reader) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// RegisterJSONScraper compiles the scraper definition and makes
+// the scraper available by name, as RegisterScraper does.
+// Its pages are decoded as JSON, instead of parsed as HTML.
+// It replaces a scraper already registered with the same name.
+func RegisterJSONScraper(name string, hosts []string, def *JSONScraper) error {
+	fn, err := def.Compile()
+	if err != nil {
+		return fmt.Errorf("%s: scraper=%q", err, name)
+	}
+	return register(name, hosts, &registeredScraper{json: fn}, true)
+}
@@ -0,0 +1,102 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileJSONPath(t *testing.T) {
+	testCases := []struct {
+		expr string
+		path jsonPath
+	}{
+		{"$.data.price", jsonPath{{key: "data", isKey: true}, {key: "price", isKey: true}}},
+		{"data.price", jsonPath{{key: "data", isKey: true}, {key: "price", isKey: true}}},
+		{"$.quotes[-1]['last price']", jsonPath{{key: "quotes", isKey: true}, {index: -1}, {key: "last price", isKey: true}}},
+		{"$[0].p", jsonPath{{index: 0}, {key: "p", isKey: true}}},
+		{"$", nil},
+		{"$.a..b", nil},
+		{"$.a[x]", nil},
+		{"$.a['b", nil},
+	}
+	for _, tc := range testCases {
+		path, err := compileJSONPath(tc.expr)
+		if tc.path == nil {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.expr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(path, tc.path) {
+			t.Errorf("%s: expected %v, found %v (%v)", tc.expr, tc.path, path, err)
+		}
+	}
+}
+
+func TestJSONScraper(t *testing.T) {
+	const page = `{"data": {"quotes": [
+		{"last": 5.1, "time": 1485475200, "ccy": "EUR"},
+		{"last": "5,158", "time": 1485561600, "ccy": "EUR"}
+	]}}`
+	v, err := decodeJSON(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := &JSONScraper{
+		Price:      "$.data.quotes[-1].last",
+		Date:       "$.data.quotes[-1].time",
+		Currency:   "$.data.quotes[-1].ccy",
+		DateLayout: "unix",
+		TimeZone:   "UTC",
+	}
+	parse, err := def.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := parse(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Price != 5.158 || res.Currency != "EUR" {
+		t.Errorf("expected 5.158 EUR, found %v %q", res.Price, res.Currency)
+	}
+	if date := time.Date(2017, 1, 28, 0, 0, 0, 0, time.UTC); !res.Date.Equal(date) {
+		t.Errorf("date: expected %v, found %v", date, res.Date)
+	}
+
+	// number price, missing date
+	def = &JSONScraper{Price: "data.quotes[0].last", Date: "data.quotes[0].date", DateLayout: "2006-01-02"}
+	parse, _ = def.Compile()
+	if _, err := parse(v); err == nil {
+		t.Error("expected date not found")
+	}
+}
+
+func TestExecuteJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"price": 12.34, "date": "2017-02-01", "currency": "USD"}`)
+	}))
+	defer srv.Close()
+
+	def := &JSONScraper{Price: "$.price", Date: "$.date", Currency: "$.currency", DateLayout: "2006-01-02"}
+	if err := RegisterJSONScraper("test.json", nil, def); err != nil {
+		t.Fatal(err)
+	}
+
+	stocks := []*Stock{{Name: "stock_1", Sources: []*StockSource{{Scraper: "test.json", URL: srv.URL}}}}
+	out, err := Execute(context.Background(), nil, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-out
+	if res.Err != nil || res.Result.Price != 12.34 || res.Result.Currency != "USD" {
+		t.Errorf("expected 12.34 USD, found %v %v", res.Result, res.Err)
+	}
+}
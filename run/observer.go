@@ -0,0 +1,30 @@
+package run
+
+import (
+	"github.com/mmbros/getstocks/workers"
+	log "github.com/sirupsen/logrus"
+)
+
+// logObserver logs the response of each request.
+type logObserver struct {
+	workers.NopObserver
+}
+
+func (logObserver) TaskFinished(ev workers.TaskEvent) {
+	toResponse(ev.Response).Log()
+}
+
+func (logObserver) TaskCancelled(ev workers.TaskEvent) {
+	if ev.Response != nil {
+		toResponse(ev.Response).Log()
+		return
+	}
+	// request skipped
+	req := ev.Request.(*request)
+	log.WithFields(log.Fields{
+		"scraper": req.scraperName,
+		"stock":   req.stockName,
+		"url":     req.URL,
+		"reason":  ev.Cause,
+	}).Info("SKIP")
+}
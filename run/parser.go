@@ -9,25 +9,34 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
-type parseResult struct {
+// Result is the quote of a stock parsed by a scraper.
+type Result struct {
 	PriceStr string
 	DateStr  string
 	Price    float32
 	Date     time.Time
+	// Currency is set by the JSON scrapers only.
+	Currency string
 }
 
-type parseDocFunc func(doc *goquery.Document) (*parseResult, error)
+// ParseFunc parses the document of a stock page.
+type ParseFunc func(doc *goquery.Document) (*Result, error)
+
+// builtinParsers are the parse functions of the builtin scrapers,
+// named after the host of their pages.
+var builtinParsers = map[string]ParseFunc{
+	"finanza.repubblica.it": parseFinanzaRepubblicaIt,
+	"www.borse.it":          parseWwwBorseIt,
+	"www.eurotlx.com":       parseWwwEurotlxCom,
+	"www.milanofinanza.it":  parseWwwMilanofinanzaIt,
+	"www.morningstar.it":    parseWwwMorningstarIt,
+	"www.teleborsa.it":      parseWwwTeleborsaIt,
+}
 
-func getParseDocFunc(scraperName string) parseDocFunc {
-	var m = map[string]parseDocFunc{
-		"finanza.repubblica.it": parseFinanzaRepubblicaIt,
-		"www.borse.it":          parseWwwBorseIt,
-		"www.eurotlx.com":       parseWwwEurotlxCom,
-		"www.milanofinanza.it":  parseWwwMilanofinanzaIt,
-		"www.morningstar.it":    parseWwwMorningstarIt,
-		"www.teleborsa.it":      parseWwwTeleborsaIt,
+func init() {
+	for host, fn := range builtinParsers {
+		RegisterScraper(host, []string{host}, fn)
 	}
-	return m[scraperName]
 }
 
 // ============================================================================
@@ -51,7 +60,7 @@ func parsePrice(str string) (float32, error) {
 	return float32(price), err
 }
 
-func (pr *parseResult) setPriceAndDate(layout string) error {
+func (pr *Result) setPriceAndDate(layout string) error {
 	var err, err2 error
 	pr.Price, err = parsePrice(pr.PriceStr)
 	pr.Date, err2 = parseDate(layout, pr.DateStr)
@@ -64,8 +73,8 @@ func (pr *parseResult) setPriceAndDate(layout string) error {
 
 // ============================================================================
 
-func parseFinanzaRepubblicaIt(doc *goquery.Document) (*parseResult, error) {
-	res := &parseResult{}
+func parseFinanzaRepubblicaIt(doc *goquery.Document) (*Result, error) {
+	res := &Result{}
 
 	doc.Find("div.TLB-scheda-body-container > ul > li:first-child > b ").EachWithBreak(func(i int, s *goquery.Selection) bool {
 		switch i {
@@ -98,8 +107,8 @@ func parseFinanzaRepubblicaIt(doc *goquery.Document) (*parseResult, error) {
       <td>30-01-2017</td>
     </tr>
 */
-func parseWwwEurotlxCom(doc *goquery.Document) (*parseResult, error) {
-	res := &parseResult{}
+func parseWwwEurotlxCom(doc *goquery.Document) (*Result, error) {
+	res := &Result{}
 
 	doc.Find("td.table_label").EachWithBreak(func(i int, s *goquery.Selection) bool {
 
@@ -123,8 +132,8 @@ func parseWwwEurotlxCom(doc *goquery.Document) (*parseResult, error) {
 //<div class="fleft w65 taright bold"><span class="cred font12 taright">-0,0618</span>
 //<div class="mtop10 bgees mbottom5"><span class="cred"> 03/02/17 18.02.03 </span>
 
-func parseWwwMilanofinanzaIt(doc *goquery.Document) (*parseResult, error) {
-	res := &parseResult{}
+func parseWwwMilanofinanzaIt(doc *goquery.Document) (*Result, error) {
+	res := &Result{}
 
 	res.PriceStr = doc.Find(".font22").Text()
 	res.DateStr = strings.TrimSpace(doc.Find("div.mbottom5 span.cred").Text())
@@ -155,8 +164,8 @@ func parseWwwMilanofinanzaIt(doc *goquery.Document) (*parseResult, error) {
 //<li class="titolo">Tipologia</li>
 //<li class="descr przAcq">F. Comuni<li>
 //</ul>
-func parseWwwBorseIt(doc *goquery.Document) (*parseResult, error) {
-	res := &parseResult{}
+func parseWwwBorseIt(doc *goquery.Document) (*Result, error) {
+	res := &Result{}
 
 	doc.Find("div.schede > ul > li.descr").EachWithBreak(func(i int, s *goquery.Selection) bool {
 		switch i {
@@ -198,8 +207,8 @@ func parseWwwBorseIt(doc *goquery.Document) (*parseResult, error) {
 //</div>
 //
 //</div>
-func parseWwwTeleborsaIt(doc *goquery.Document) (*parseResult, error) {
-	res := &parseResult{}
+func parseWwwTeleborsaIt(doc *goquery.Document) (*Result, error) {
+	res := &Result{}
 
 	res.PriceStr = doc.Find("#ctl00_phContents_ctlHeader_lblPrice").Text()
 	res.DateStr = doc.Find("#ctl00_phContents_ctlHeader_pnlHeaderBottom strong").Text()
@@ -216,8 +225,8 @@ func parseWwwTeleborsaIt(doc *goquery.Document) (*parseResult, error) {
 //       <td class="line"> </td>
 //       <td class="line text">EUR 5,158</td></tr>
 //   <tr><td class="line heading">Var.Ultima Quotazione</td><td class="line"> </td><td class="line text">-0,04%
-func parseWwwMorningstarIt(doc *goquery.Document) (*parseResult, error) {
-	res := &parseResult{}
+func parseWwwMorningstarIt(doc *goquery.Document) (*Result, error) {
+	res := &Result{}
 
 	doc.Find("table.overviewKeyStatsTable td").EachWithBreak(func(i int, s *goquery.Selection) bool {
 		switch i {
@@ -0,0 +1,99 @@
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Quota limits the number of downloads of a scraper, e.g. per day.
+// Each download from the server takes one from the quota, right before
+// the request: the pages shared with other requests or got from the cache
+// don't take any. Once exhausted, the downloads fail with
+// workers.ErrQuotaExhausted, and the scraper is not scheduled anymore.
+// The quota is enforced by the clients of NewClient.
+// Take is called by many requests at the same time.
+type Quota interface {
+	// Take reports whether a download is allowed, taking it from the quota.
+	Take() bool
+}
+
+// QuotaStore keeps the requests of the day of the scrapers with a quota,
+// persisted in a state file across the runs.
+type QuotaStore struct {
+	mu    sync.Mutex
+	path  string
+	now   func() time.Time
+	state map[string]*quotaState // by scraper
+}
+
+// quotaState is the state of the quota of a scraper.
+type quotaState struct {
+	Day  string `json:"day"`
+	Used int    `json:"used"`
+}
+
+// LoadQuotaStore returns the store of the state file.
+// A missing file is an empty state.
+func LoadQuotaStore(path string) (*QuotaStore, error) {
+	s := &QuotaStore{path: path, now: time.Now, state: map[string]*quotaState{}}
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &s.state); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Quota returns the quota of the scraper, allowing limit requests per day.
+func (s *QuotaStore) Quota(scraper string, limit int) Quota {
+	return &dailyQuota{store: s, scraper: scraper, limit: limit}
+}
+
+type dailyQuota struct {
+	store   *QuotaStore
+	scraper string
+	limit   int
+}
+
+func (q *dailyQuota) Take() bool { return q.store.take(q.scraper, q.limit) }
+
+// take takes a request of the day from the quota of the scraper,
+// saving the state file. An error saving the state is logged only:
+// the quota is enforced anyway within the run.
+func (s *QuotaStore) take(scraper string, limit int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := s.now().Format("2006-01-02")
+	st := s.state[scraper]
+	if st == nil || st.Day != day {
+		st = &quotaState{Day: day}
+		s.state[scraper] = st
+	}
+	if st.Used >= limit {
+		return false
+	}
+	st.Used++
+	if err := s.save(); err != nil {
+		log.WithField("file", s.path).Error(err)
+	}
+	return true
+}
+
+// save writes the state file.
+func (s *QuotaStore) save() error {
+	buf, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(s.path, buf)
+}
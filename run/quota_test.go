@@ -0,0 +1,178 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmbros/getstocks/workers"
+)
+
+// countQuota allows a fixed number of downloads.
+type countQuota struct {
+	left  int32
+	taken int32
+}
+
+func (q *countQuota) Take() bool {
+	if atomic.AddInt32(&q.left, -1) < 0 {
+		return false
+	}
+	atomic.AddInt32(&q.taken, 1)
+	return true
+}
+
+// testQuotaServer serves the test page, with the given status.
+func testQuotaServer(status int, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.WriteHeader(status)
+		fmt.Fprint(w, `<span id="price">12,34</span><span id="date">01/02/2017</span>`)
+	}))
+}
+
+func TestQuotaStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "getstocks.state")
+	day := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+
+	load := func() *QuotaStore {
+		s, err := LoadQuotaStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.now = func() time.Time { return day }
+		return s
+	}
+	take := func(q interface{ Take() bool }, expected ...bool) {
+		t.Helper()
+		for j, exp := range expected {
+			if found := q.Take(); found != exp {
+				t.Errorf("take %d: expected %v, found %v", j+1, exp, found)
+			}
+		}
+	}
+
+	s := load()
+	take(s.Quota("a", 2), true)
+	take(s.Quota("b", 1), true, false)
+
+	// the requests of the day are kept across the runs
+	s = load()
+	take(s.Quota("a", 2), true, false)
+	take(s.Quota("b", 1), false)
+
+	// the quota is reset the next day
+	day = day.Add(24 * time.Hour)
+	take(s.Quota("a", 2), true, true, false)
+}
+
+func TestQuotaDownloads(t *testing.T) {
+	var hits int32
+	srv := testQuotaServer(http.StatusOK, &hits)
+	defer srv.Close()
+
+	// stock_1 and stock_2 share the same download
+	quota := &countQuota{left: 2}
+	stocks := []*Stock{
+		{Name: "stock_1", Sources: []*StockSource{{Scraper: "test.scraper", URL: srv.URL + "/a"}}},
+		{Name: "stock_2", Sources: []*StockSource{{Scraper: "test.scraper", URL: srv.URL + "/a"}}},
+		{Name: "stock_3", Sources: []*StockSource{{Scraper: "test.scraper", URL: srv.URL + "/b"}}},
+		{Name: "stock_4", Sources: []*StockSource{{Scraper: "test.scraper", URL: srv.URL + "/c"}}},
+	}
+	out, err := Execute(context.Background(), []*Scraper{{Name: "test.scraper", Workers: 1, Quota: quota}}, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var successes, exhausted int
+	for res := range out {
+		switch {
+		case res.Err == nil:
+			successes++
+		case errors.Is(res.Err, workers.ErrQuotaExhausted):
+			exhausted++
+		default:
+			t.Errorf("%s: unexpected error %v", res.StockName, res.Err)
+		}
+	}
+	if successes != 3 || exhausted != 1 || hits != 2 {
+		t.Errorf("expected 3 successes, 1 quota exhausted and 2 hits, found %d, %d and %d", successes, exhausted, hits)
+	}
+}
+
+func TestQuotaCircuitOpen(t *testing.T) {
+	var hits int32
+	srv := testQuotaServer(http.StatusNotFound, &hits)
+	defer srv.Close()
+
+	// the requests rejected by the open circuit don't take the quota
+	quota := &countQuota{left: 10}
+	scrapers := []*Scraper{{
+		Name:    "test.scraper",
+		Workers: 1,
+		Breaker: workers.CircuitBreaker{ConsecutiveFailures: 1},
+		Quota:   quota,
+	}}
+	var stocks []*Stock
+	for j := 1; j <= 3; j++ {
+		url := fmt.Sprintf("%s/%d", srv.URL, j)
+		stocks = append(stocks, &Stock{Name: fmt.Sprintf("stock_%d", j), Sources: []*StockSource{{Scraper: "test.scraper", URL: url}}})
+	}
+	out, err := Execute(context.Background(), scrapers, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var open int
+	for res := range out {
+		if errors.Is(res.Err, workers.ErrCircuitOpen) {
+			open++
+		}
+	}
+	if open != 2 || quota.taken != 1 {
+		t.Errorf("expected 2 circuit open and 1 quota taken, found %d and %d", open, quota.taken)
+	}
+}
+
+func TestQuotaCache(t *testing.T) {
+	var hits int32
+	srv := testQuotaServer(http.StatusOK, &hits)
+	defer srv.Close()
+
+	cache, err := NewCache(t.TempDir(), CacheNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ClientConfig{Cache: cache, CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota := &countQuota{left: 1}
+	ctx := withFetchSettings(context.Background(), &fetchSettings{quota: quota})
+	get := func(url string) error {
+		resp, err := getPage(ctx, client, url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(srv.URL + "/a"); err != nil {
+		t.Fatal(err)
+	}
+	// the cached page doesn't take the quota
+	if err := get(srv.URL + "/a"); err != nil {
+		t.Fatal(err)
+	}
+	// no download once the quota is used up
+	if err := get(srv.URL + "/b"); !errors.Is(err, workers.ErrQuotaExhausted) {
+		t.Errorf("expected %v, found %v", workers.ErrQuotaExhausted, err)
+	}
+	if hits != 1 {
+		t.Errorf("expected 1 hit, found %d", hits)
+	}
+}
@@ -0,0 +1,115 @@
+package run
+
+import (
+	"fmt"
+	"sync"
+)
+
+// registeredScraper is a scraper of the registry:
+// a stock scraper of HTML or JSON pages, or a batch scraper.
+type registeredScraper struct {
+	parse ParseFunc
+	json  JSONParseFunc
+	batch BatchParseFunc
+}
+
+// registry of the scrapers, by name, and of their hosts.
+var registry = struct {
+	sync.RWMutex
+	scrapers map[string]*registeredScraper
+	hosts    map[string]string // scraper name by host
+}{
+	scrapers: map[string]*registeredScraper{},
+	hosts:    map[string]string{},
+}
+
+// RegisterScraper makes the scraper available by name, parsing its pages
+// with fn. GetScraperFromUrl returns the scraper for the urls of the hosts.
+// It panics if fn is nil, or if the name or a host is already registered.
+func RegisterScraper(name string, hosts []string, fn ParseFunc) {
+	if fn == nil {
+		panic(fmt.Sprintf("Parse function cannot be nil: scraper=%q", name))
+	}
+	if err := register(name, hosts, &registeredScraper{parse: fn}, false); err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterBatchScraper makes the batch scraper available by name,
+// parsing its pages with fn.
+// It panics if fn is nil, or if the name is already registered.
+func RegisterBatchScraper(name string, fn BatchParseFunc) {
+	if fn == nil {
+		panic(fmt.Sprintf("Parse function cannot be nil: scraper=%q", name))
+	}
+	if err := register(name, nil, &registeredScraper{batch: fn}, false); err != nil {
+		panic(err.Error())
+	}
+}
+
+// register adds the scraper to the registry.
+// If replace, a scraper with the same name is replaced, hosts included.
+func register(name string, hosts []string, scr *registeredScraper, replace bool) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.scrapers[name]; ok && !replace {
+		return fmt.Errorf("Scraper already registered: %q", name)
+	}
+	for _, host := range hosts {
+		if other, ok := registry.hosts[host]; ok && other != name {
+			return fmt.Errorf("Host already registered: host=%q, scraper=%q", host, other)
+		}
+	}
+	for host, other := range registry.hosts {
+		if other == name {
+			delete(registry.hosts, host)
+		}
+	}
+	registry.scrapers[name] = scr
+	for _, host := range hosts {
+		registry.hosts[host] = name
+	}
+	return nil
+}
+
+// getParseDocFunc returns the parse function of the scraper,
+// or nil if not registered.
+func getParseDocFunc(scraperName string) ParseFunc {
+	registry.RLock()
+	defer registry.RUnlock()
+	if scr := registry.scrapers[scraperName]; scr != nil {
+		return scr.parse
+	}
+	return nil
+}
+
+// getParseJSONFunc returns the parse function of the JSON scraper,
+// or nil if not registered.
+func getParseJSONFunc(scraperName string) JSONParseFunc {
+	registry.RLock()
+	defer registry.RUnlock()
+	if scr := registry.scrapers[scraperName]; scr != nil {
+		return scr.json
+	}
+	return nil
+}
+
+// getParseBatchFunc returns the parse function of the batch scraper,
+// or nil if not registered.
+func getParseBatchFunc(scraperName string) BatchParseFunc {
+	registry.RLock()
+	defer registry.RUnlock()
+	if scr := registry.scrapers[scraperName]; scr != nil {
+		return scr.batch
+	}
+	return nil
+}
+
+// scraperOfHost returns the name of the scraper of the host.
+func scraperOfHost(host string) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	name, ok := registry.hosts[host]
+	return name, ok
+}
@@ -0,0 +1,84 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func init() {
+	RegisterScraper("test.scraper", []string{"quotes.test", "www.quotes.test"}, parseTestScraper)
+}
+
+// parseTestScraper parses the price and date of the test page.
+func parseTestScraper(doc *goquery.Document) (*Result, error) {
+	res := &Result{
+		PriceStr: doc.Find("#price").Text(),
+		DateStr:  doc.Find("#date").Text(),
+	}
+	return res, res.setPriceAndDate("02/01/2006")
+}
+
+func TestGetScraperFromUrl(t *testing.T) {
+	testCases := []struct {
+		url     string
+		scraper string
+		err     bool
+	}{
+		{"http://www.quotes.test/IT0001", "test.scraper", false},
+		{"https://quotes.test/", "test.scraper", false},
+		{"https://www.teleborsa.it/x", "www.teleborsa.it", false},
+		{"https://unknown.test/", "unknown.test", true},
+	}
+	for _, tc := range testCases {
+		scraper, err := GetScraperFromUrl(tc.url)
+		if scraper != tc.scraper || (err != nil) != tc.err {
+			t.Errorf("%s: expected %q (error %v), found %q (%v)", tc.url, tc.scraper, tc.err, scraper, err)
+		}
+	}
+}
+
+func TestRegisterScraperTwice(t *testing.T) {
+	testCases := map[string]func(){
+		"name": func() { RegisterScraper("test.scraper", nil, parseTestScraper) },
+		"host": func() { RegisterScraper("test.other", []string{"quotes.test"}, parseTestScraper) },
+		"nil":  func() { RegisterScraper("test.nil", nil, nil) },
+	}
+	for name, register := range testCases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func TestExecuteRegistered(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<span id="price">12,34</span><span id="date">01/02/2017</span>`)
+	}))
+	defer srv.Close()
+
+	stocks := []*Stock{{Name: "stock_1", Sources: []*StockSource{{Scraper: "test.scraper", URL: srv.URL}}}}
+	out, err := Execute(context.Background(), nil, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-out
+	if res.Err != nil || res.Result.Price != 12.34 {
+		t.Errorf("expected price 12.34, found %v %v", res.Result, res.Err)
+	}
+
+	// unknown scraper
+	stocks[0].Sources[0].Scraper = "test.unknown"
+	if _, err := Execute(context.Background(), nil, stocks); err == nil {
+		t.Error("expected error for unknown scraper")
+	}
+}
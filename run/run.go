@@ -2,7 +2,9 @@ package run
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	neturl "net/url"
 	"time"
@@ -13,8 +15,25 @@ import (
 )
 
 type Scraper struct {
-	Name    string
-	Workers int
+	Name      string
+	Workers   int
+	RateLimit workers.RateLimit
+	Retry     workers.RetryPolicy
+	Timeout   time.Duration
+	Breaker   workers.CircuitBreaker
+	Scaling   workers.Scaling
+	Quota     Quota        // nil means no quota
+	Client    *http.Client // nil means DefaultClient
+
+	// CacheTTL is the age of the cached pages of the scraper after which
+	// they are revalidated. Zero means the CacheTTL of the client.
+	CacheTTL time.Duration
+
+	// BatchURL is the page of a batch scraper, with the quotes of many stocks.
+	// Each stock with an ISIN gets the page as a source, listed before its
+	// own ones: it's tried first in hedging mode, alongside them otherwise.
+	// The parser of the page is registered by RegisterBatchScraper.
+	BatchURL string
 }
 
 type Stock struct {
@@ -58,6 +77,7 @@ type request struct {
 	scraperName string
 	stockName   string
 	URL         string
+	isin        string // batch scrapers only
 }
 
 func (req *request) WorkerID() workers.WorkerKey { return workers.WorkerKey(req.scraperName) }
@@ -67,14 +87,110 @@ type Response struct {
 	ScraperName string
 	StockName   string
 	URL         string
-	Result      *parseResult
+	Result      *Result
 	TimeStart   time.Time
 	TimeEnd     time.Time
 	Err         error
+
+	// Consensus mode only: the success responses of the sources
+	// and the ones whose price disagrees with the consensus price.
+	Sources     []*Response
+	Disagreeing []*Response
+
+	// Verbose mode only: the sources tried for the stock.
+	Attempts []*Attempt
+}
+
+// Attempt is a source tried for a stock, with its outcome.
+// The embedded Response has no Result if the source
+// was never started or was cancelled.
+type Attempt struct {
+	*Response
+	Outcome workers.Outcome
 }
 
 func (res *Response) Success() bool { return res.Err == nil }
 
+// toResponse converts the workers.Response into *Response.
+func toResponse(wres workers.Response) *Response {
+	switch r := wres.(type) {
+	case *Response:
+		return r
+	case *workers.JobError:
+		// job terminated without any response, e.g. for timeout
+		return &Response{StockName: string(r.Job), Err: r.Err}
+	case *workers.PanicError:
+		// the scraper panicked
+		req := r.Request.(*request)
+		return &Response{
+			ScraperName: req.scraperName,
+			StockName:   req.stockName,
+			URL:         req.URL,
+			Err:         r,
+		}
+	case *workers.TaskError:
+		// request not worked, e.g. for circuit open
+		req := r.Request.(*request)
+		return &Response{
+			ScraperName: req.scraperName,
+			StockName:   req.stockName,
+			URL:         req.URL,
+			Err:         r.Err,
+		}
+	}
+	return nil
+}
+
+// errorResponse returns the *Response of a job terminated with the error.
+func errorResponse(job workers.JobKey, err error) *Response {
+	if wres, ok := err.(workers.Response); ok {
+		if res := toResponse(wres); res != nil {
+			return res
+		}
+	}
+	return &Response{StockName: string(job), Err: err}
+}
+
+// StatusError is the error of a response with a not OK http status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string { return e.Status }
+
+// retryableResponse reports whether the failed response can be retried,
+// i.e. in case of a network error or a temporary http error status.
+// Errors parsing the document are not retried,
+// nor the panics, the requests not worked, the pages not cached offline
+// and the downloads over quota.
+func retryableResponse(wres workers.Response) bool {
+	res, ok := wres.(*Response)
+	if !ok || errors.Is(res.Err, ErrNotCached) || errors.Is(res.Err, workers.ErrQuotaExhausted) {
+		return false
+	}
+	if e, ok := res.Err.(*StatusError); ok {
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	}
+	_, ok = res.Err.(net.Error)
+	return ok
+}
+
+// quotaExhausted reports whether the response failed
+// for the quota of the scraper exhausted.
+func quotaExhausted(wres workers.Response) bool {
+	res, ok := wres.(*Response)
+	return ok && errors.Is(res.Err, workers.ErrQuotaExhausted)
+}
+
+// neutralResponse reports whether the response failed for reasons
+// not depending on the health of the scraper, e.g. a stock not in the
+// batch page: it doesn't count for the circuit breaker and the scaling.
+func neutralResponse(wres workers.Response) bool {
+	res, ok := wres.(*Response)
+	return ok && skipped(res.Err)
+}
+
 func (res *Response) Log() {
 
 	contextLogger := log.WithFields(log.Fields{
@@ -90,154 +206,342 @@ func (res *Response) Log() {
 			"price": res.Result.PriceStr,
 		})
 	}
-	if res.Err != nil {
-		if res.Err == context.Canceled {
-			contextLogger.Info("SKIP")
-		} else {
-			contextLogger.Error(res.Err)
-		}
-	} else {
+	if perr, ok := res.Err.(*workers.PanicError); ok {
+		contextLogger = contextLogger.WithField("stack", string(perr.Stack))
+	}
+	switch {
+	case res.Err == nil:
 		contextLogger.Info("SUCCESS")
+	case skipped(res.Err):
+		contextLogger.WithField("reason", res.Err).Info("SKIP")
+	default:
+		contextLogger.Error(res.Err)
 	}
 
 }
 
+// skipped reports whether the error is the cause of a request not worked
+// or interrupted for reasons not depending on the scraper.
+func skipped(err error) bool {
+	return errors.Is(err, workers.ErrSiblingSucceeded) ||
+		errors.Is(err, workers.ErrRunCancelled) ||
+		errors.Is(err, workers.ErrCircuitOpen) ||
+		errors.Is(err, workers.ErrQuotaExhausted) ||
+		errors.Is(err, ErrNotInBatch) ||
+		errors.Is(err, context.Canceled)
+}
+
 // ----------------------------------------------------------------------------
 
+// GetScraperFromUrl returns the name of the registered scraper
+// of the host of the url.
 func GetScraperFromUrl(url string) (string, error) {
 	// Get the host form url
 	u, err := neturl.Parse(url)
 	if err != nil {
 		return "", err
 	}
-	name := u.Host
-	// Checks if to the name corresponds a ParseDocFunc.
+	// Checks if to the host corresponds a registered scraper.
 	// It returns anyway the supposed name of the scraper.
-	if getParseDocFunc(name) == nil {
-		return name, fmt.Errorf("No scraper found for url %q", url)
+	name, ok := scraperOfHost(u.Host)
+	if !ok {
+		return u.Host, fmt.Errorf("No scraper found for url %q", url)
 	}
 	return name, nil
 }
 
-func getUrl(ctx context.Context, url string) (*http.Response, error) {
-
-	type result struct {
-		resp *http.Response
-		err  error
+// getUrl gets the url with the client.
+// The request is cancelled when the context is done.
+func getUrl(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
 	}
+	return client.Do(req)
+}
 
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-		// make the request
-		tr := &http.Transport{}
-		client := &http.Client{Transport: tr}
-
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, err
+// scraperWorker is the worker of a scraper.
+type scraperWorker = workers.TypedWorker[*request, *Response]
+
+// scraperWorkFunc returns the work function of the scrapers,
+// sharing the identical downloads by the coalescer.
+// The scrapers without a client use DefaultClient.
+func scraperWorkFunc(c *coalescer, fetches map[string]*fetchSettings) func(context.Context, *request) *Response {
+	return func(ctx context.Context, req *request) *Response {
+		client := DefaultClient
+		if fs := fetches[req.scraperName]; fs != nil {
+			if fs.client != nil {
+				client = fs.client
+			}
+			ctx = withFetchSettings(ctx, fs)
 		}
 
-		c := make(chan result, 1)
-
-		go func() {
-			resp, err := client.Do(req)
-			c <- result{resp: resp, err: err}
+		// init the result
+		response := &Response{
+			ScraperName: req.scraperName,
+			StockName:   req.stockName,
+			URL:         req.URL,
+			TimeStart:   time.Now(),
+		}
+		// use defer to set timeEnd
+		defer func() {
+			response.TimeEnd = time.Now()
 		}()
 
-		select {
-		case <-ctx.Done():
-			tr.CancelRequest(req)
-			<-c // Wait for client.Do
-			return nil, ctx.Err()
-		case r := <-c:
-			return r.resp, r.err
+		key := req.scraperName + " " + req.URL
+		if req.isin == "" {
+			var v interface{}
+			v, response.Err = c.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+				return scrape(ctx, client, req.scraperName, req.URL)
+			})
+			if response.Err == nil {
+				response.Result = v.(*Result)
+			}
+		} else {
+			// the page of a batch scraper is downloaded once for all the stocks,
+			// unless failed
+			var v interface{}
+			v, response.Err = c.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+				return scrapeBatch(ctx, client, req.scraperName, req.URL)
+			})
+			if response.Err == nil {
+				response.Result, response.Err = v.(*batchPage).result(req.isin)
+			}
+		}
+		if perr, ok := response.Err.(*panicError); ok {
+			// the scraper panicked in the shared download
+			response.Err = &workers.PanicError{Request: req, Value: perr.value, Stack: perr.stack}
 		}
+		if response.Err != nil && ctx.Err() != nil {
+			// report why the job cancelled the request, e.g. a sibling succeeded
+			if cause := context.Cause(ctx); cause != nil {
+				response.Err = cause
+			}
+		}
+		return response
 	}
 }
 
-//type WorkFunc func(context.Context, Request) Response
-func scraperWorkFunc(ctx context.Context, wreq workers.Request) workers.Response {
+// getPage gets the url, checking the http status.
+func getPage(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	// get the http response
+	resp, err := getUrl(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{resp.StatusCode, resp.Status}
+	}
+	return resp, nil
+}
 
-	//workers.Request -> *request
-	//workers.Response -> Response
-	req := wreq.(*request)
+// getDoc gets the url and returns its goquery document.
+func getDoc(ctx context.Context, client *http.Client, url string) (*goquery.Document, error) {
+	resp, err := getPage(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	// create goquery document
+	return goquery.NewDocumentFromResponse(resp)
+}
 
-	// init the result
-	response := &Response{
-		ScraperName: req.scraperName,
-		StockName:   req.stockName,
-		URL:         req.URL,
-		TimeStart:   time.Now(),
+// scrape gets the url and parses the page with the scraper:
+// as JSON for the JSON scrapers, as an HTML document otherwise.
+func scrape(ctx context.Context, client *http.Client, scraperName, url string) (*Result, error) {
+	if parseJSON := getParseJSONFunc(scraperName); parseJSON != nil {
+		resp, err := getPage(ctx, client, url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		v, err := decodeJSON(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return parseJSON(v)
 	}
-	// use defer to set timeEnd
-	defer func() {
-		response.TimeEnd = time.Now()
 
-		response.Log()
-	}()
+	doc, err := getDoc(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	// parse the response
+	parseFunc := getParseDocFunc(scraperName)
+	return parseFunc(doc)
+}
 
-	// get the http response
-	resp, err := getUrl(ctx, req.URL)
+// Execute scrapes the stocks with the scrapers,
+// and sends the response of each stock to the returned channel.
+func Execute(ctx context.Context, scrapers []*Scraper, stocks []*Stock, opts ...workers.Option) (<-chan *Response, error) {
+	wrks, reqs, err := workersArgs(scrapers, stocks)
 	if err != nil {
-		response.Err = err
-		return response
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		response.Err = fmt.Errorf(resp.Status)
-		return response
+
+	// Call workers.ExecuteTyped to do the job, logging the responses
+	opts = append([]workers.Option{workers.Observe(logObserver{})}, opts...)
+	wout, err := workers.ExecuteTyped(ctx, wrks, reqs, opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	// create goquery document
-	doc, err := goquery.NewDocumentFromResponse(resp)
+	// Creates the output channel
+	out := make(chan *Response)
+
+	// Starts a goroutine that:
+	// 1. get each result from the wout channel,
+	// 2. traforms it to *run.Response type,
+	// 3. sends it to the out channel.
+	go func() {
+		for r := range wout {
+			if r.Err != nil {
+				out <- errorResponse(r.Job, r.Err)
+			} else {
+				out <- r.Response
+			}
+		}
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// ExecuteVerbose is like Execute, but each response
+// also has the Attempts of all the sources of the stock.
+func ExecuteVerbose(ctx context.Context, scrapers []*Scraper, stocks []*Stock, opts ...workers.Option) (<-chan *Response, error) {
+	wrks, reqs, err := workersArgs(scrapers, stocks)
 	if err != nil {
-		response.Err = err
-		return response
+		return nil, err
 	}
-	// parse the response
-	parseFunc := getParseDocFunc(req.scraperName)
-	response.Result, err = parseFunc(doc)
+
+	// the attempts are returned by the interface-based API only
+	uwrks := make([]*workers.Worker, 0, len(wrks))
+	for _, w := range wrks {
+		uwrks = append(uwrks, w.Adapt())
+	}
+	ureqs := make([]workers.Request, 0, len(reqs))
+	for _, r := range reqs {
+		ureqs = append(ureqs, r)
+	}
+
+	opts = append([]workers.Option{workers.Observe(logObserver{})}, opts...)
+	wout, err := workers.ExecuteVerbose(ctx, uwrks, ureqs, opts...)
 	if err != nil {
-		response.Err = err
-		return response
+		return nil, err
 	}
 
-	return response
+	out := make(chan *Response)
+	go func() {
+		for result := range wout {
+			res := toResponse(result.Response)
+			if res == nil {
+				// e.g. the response of a custom Reducer
+				res = errorResponse(result.Job, fmt.Errorf("Unexpected response type %T: job=%q", result.Response, result.Job))
+			}
+			for _, a := range result.Attempts {
+				res.Attempts = append(res.Attempts, toAttempt(a))
+			}
+			out <- res
+		}
+		close(out)
+	}()
+
+	return out, nil
+}
 
+// toAttempt converts a workers.Attempt to *Attempt.
+func toAttempt(a workers.Attempt) *Attempt {
+	if a.Response != nil {
+		return &Attempt{Response: toResponse(a.Response), Outcome: a.Outcome}
+	}
+	req := a.Request.(*request)
+	res := &Response{
+		ScraperName: req.scraperName,
+		StockName:   req.stockName,
+		URL:         req.URL,
+		TimeStart:   a.TimeStart,
+	}
+	if a.Outcome == workers.Cancelled {
+		res.Err = a.Cause
+	}
+	return &Attempt{Response: res, Outcome: a.Outcome}
 }
 
-func Execute(ctx context.Context, scrapers []*Scraper, stocks []*Stock) (<-chan *Response, error) {
+// workersArgs returns the workers and the requests
+// corresponding to the scrapers and the stocks.
+func workersArgs(scrapers []*Scraper, stocks []*Stock) ([]*scraperWorker, []*request, error) {
 	usedWorkers := NewSet()
 
-	// init list of workers.Worker
-	wrks := make([]*workers.Worker, 0, len(scrapers))
+	// the identical downloads of the run are shared
+	fetches := map[string]*fetchSettings{}
+	for _, scr := range scrapers {
+		fetches[scr.Name] = &fetchSettings{client: scr.Client, cacheTTL: scr.CacheTTL, quota: scr.Quota}
+	}
+	work := scraperWorkFunc(newCoalescer(), fetches)
+
+	// init list of workers
+	wrks := make([]*scraperWorker, 0, len(scrapers))
+	var batches []*Scraper
 	for _, scr := range scrapers {
 		if !usedWorkers.Add(scr.Name) {
 			// duplicate Scraper
-			return nil, fmt.Errorf("Duplicate scraper %q", scr.Name)
+			return nil, nil, fmt.Errorf("Duplicate scraper %q", scr.Name)
 		}
 
-		w := &workers.Worker{
-			WorkerID:  workers.WorkerKey(scr.Name),
-			Instances: scr.Workers,
-			Work:      scraperWorkFunc,
+		w := &scraperWorker{
+			Worker: workers.Worker{
+				WorkerID:  workers.WorkerKey(scr.Name),
+				Instances: scr.Workers,
+				RateLimit: scr.RateLimit,
+				Retry:     scr.Retry,
+				Timeout:   scr.Timeout,
+
+				CircuitBreaker: scr.Breaker,
+				Scaling:        scr.Scaling,
+			},
+			Work: work,
+		}
+		if w.Retry.Retryable == nil {
+			w.Retry.Retryable = retryableResponse
+		}
+		if scr.Quota != nil {
+			w.Exhausted = quotaExhausted
 		}
+		w.Neutral = neutralResponse
 		wrks = append(wrks, w)
+		if scr.BatchURL != "" {
+			batches = append(batches, scr)
+		}
 	}
 
-	// Init list of workers.Request.
+	// Init list of requests.
 	// Assumes each stock has 3 sources.
-	reqs := make([]workers.Request, 0, 3*len(stocks))
+	reqs := make([]*request, 0, 3*len(stocks))
 	for _, stock := range stocks {
+		// the batch pages are listed before the stock's own sources,
+		// so they are tried first in hedging mode
+		if stock.Isin != "" {
+			for _, scr := range batches {
+				r := &request{
+					scraperName: scr.Name,
+					stockName:   stock.Name,
+					URL:         scr.BatchURL,
+					isin:        stock.Isin,
+				}
+				reqs = append(reqs, r)
+			}
+		}
 		for _, src := range stock.Sources {
 
 			// check source's scraper
 			if usedWorkers.Add(src.Scraper) {
-				w := &workers.Worker{
-					WorkerID:  workers.WorkerKey(src.Scraper),
-					Instances: 1,
-					Work:      scraperWorkFunc,
+				w := &scraperWorker{
+					Worker: workers.Worker{
+						WorkerID:  workers.WorkerKey(src.Scraper),
+						Instances: 1,
+					},
+					Work: work,
 				}
 				wrks = append(wrks, w)
 			}
@@ -251,33 +555,24 @@ func Execute(ctx context.Context, scrapers []*Scraper, stocks []*Stock) (<-chan
 		}
 	}
 	// check scraper exists !!!
+	batchWorkers := NewSet()
+	for _, scr := range batches {
+		if getParseBatchFunc(scr.Name) == nil {
+			return nil, nil, fmt.Errorf("Batch scraper not found: %q", scr.Name)
+		}
+		batchWorkers.Add(scr.Name)
+	}
 	for _, w := range wrks {
 		name := string(w.WorkerID)
-		if getParseDocFunc(name) == nil {
-			return nil, fmt.Errorf("Scraper not found: %q", name)
+		if !batchWorkers.Contains(name) && getParseDocFunc(name) == nil && getParseJSONFunc(name) == nil {
+			return nil, nil, fmt.Errorf("Scraper not found: %q", name)
 		}
 	}
-
-	// Call workers.Execute to do the job
-	wout, err := workers.Execute(ctx, wrks, reqs)
-	if err != nil {
-		return nil, err
-	}
-
-	// Creates the output channel
-	out := make(chan *Response)
-
-	// Starts a goroutine that:
-	// 1. get each workers.Response from the wout channel,
-	// 2. traforms it to *run.Response type,
-	// 3. sends it to the out channel.
-	go func() {
-		for wres := range wout {
-			res := wres.(*Response)
-			out <- res
+	for _, r := range reqs {
+		if r.isin == "" && batchWorkers.Contains(r.scraperName) {
+			return nil, nil, fmt.Errorf("Batch scraper used as a stock source: scraper=%q, stock=%q", r.scraperName, r.stockName)
 		}
-		close(out)
-	}()
+	}
 
-	return out, nil
+	return wrks, reqs, nil
 }
@@ -0,0 +1,90 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmbros/getstocks/workers"
+)
+
+// calls of the test.retry.panic scraper
+var retryPanicCalls int32
+
+func init() {
+	RegisterScraper("test.retry.panic", nil, func(doc *goquery.Document) (*Result, error) {
+		atomic.AddInt32(&retryPanicCalls, 1)
+		panic("parser bug")
+	})
+}
+
+func TestRetryableResponse(t *testing.T) {
+	req := &request{scraperName: "test.scraper", stockName: "stock_1"}
+	testCases := []struct {
+		res       workers.Response
+		retryable bool
+	}{
+		{&Response{Err: &StatusError{503, "503 Service Unavailable"}}, true},
+		{&Response{Err: &StatusError{404, "404 Not Found"}}, false},
+		{&Response{Err: errors.New("parse error")}, false},
+		{&workers.PanicError{Request: req, Value: "bug"}, false},
+		{&workers.TaskError{Request: req, Err: workers.ErrCircuitOpen}, false},
+		{&workers.JobError{Job: "stock_1", Err: workers.ErrJobTimeout}, false},
+	}
+	for j, tc := range testCases {
+		if retryable := retryableResponse(tc.res); retryable != tc.retryable {
+			t.Errorf("%d: expected %v, found %v", j, tc.retryable, retryable)
+		}
+	}
+}
+
+func TestExecuteRetryPanic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	atomic.StoreInt32(&retryPanicCalls, 0)
+	stocks := []*Stock{{Name: "stock_1", Sources: []*StockSource{{Scraper: "test.retry.panic", URL: srv.URL}}}}
+	scrapers := []*Scraper{{Name: "test.retry.panic", Workers: 1, Retry: workers.RetryPolicy{MaxAttempts: 3}}}
+	out, err := Execute(context.Background(), scrapers, stocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for res := range out {
+		if _, ok := res.Err.(*workers.PanicError); !ok {
+			t.Errorf("expected PanicError, found %v", res.Err)
+		}
+	}
+	// panics are not retried
+	if calls := atomic.LoadInt32(&retryPanicCalls); calls != 1 {
+		t.Errorf("expected 1 call, found %d", calls)
+	}
+}
+
+// otherResponse is a response of a custom Reducer.
+type otherResponse struct{}
+
+func (otherResponse) Success() bool { return true }
+
+func TestExecuteVerboseReducer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<span id="price">12,34</span><span id="date">01/02/2017</span>`)
+	}))
+	defer srv.Close()
+
+	reduce := func(job workers.JobKey, responses []workers.Response) workers.Response { return otherResponse{} }
+	stocks := []*Stock{{Name: "stock_1", Sources: []*StockSource{{Scraper: "test.scraper", URL: srv.URL}}}}
+	out, err := ExecuteVerbose(context.Background(), nil, stocks, workers.Quorum(1, reduce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for res := range out {
+		if res.StockName != "stock_1" || res.Err == nil || len(res.Attempts) != 1 {
+			t.Errorf("expected error response of stock_1 with 1 attempt, found %+v", res)
+		}
+	}
+}
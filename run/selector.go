@@ -0,0 +1,140 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// default time zone of the dates of the declarative scrapers
+const defaultTimeZone = "Europe/Rome"
+
+// SelectorScraper is a scraper defined by the CSS selectors
+// of the price and the date of the stock page.
+type SelectorScraper struct {
+	Price Selector
+	Date  Selector
+	// DateLayout is the layout of the date, as in time.Parse.
+	DateLayout string
+	// TimeZone is the location of the date, e.g. "Europe/Rome".
+	// Empty means "Europe/Rome".
+	TimeZone string
+}
+
+// Selector selects a text of the document.
+type Selector struct {
+	// CSS is the selector of the nodes.
+	CSS string
+	// Nth is the index of the node among the matching ones, starting from 0.
+	Nth int
+	// Regexp, if not empty, cleans up the text of the node: the text is
+	// its first submatch, or the whole match if it has no groups.
+	Regexp string
+}
+
+// compiledSelector is a Selector ready to be used.
+type compiledSelector struct {
+	sel cascadia.Selector
+	nth int
+	re  *regexp.Regexp
+}
+
+func (s *Selector) compile() (*compiledSelector, error) {
+	if s.CSS == "" {
+		return nil, errors.New("Selector cannot be empty")
+	}
+	if s.Nth < 0 {
+		return nil, fmt.Errorf("Selector nth cannot be negative: %d", s.Nth)
+	}
+	sel, err := cascadia.Compile(s.CSS)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid selector %q: %s", s.CSS, err)
+	}
+	cs := &compiledSelector{sel: sel, nth: s.Nth}
+	if s.Regexp != "" {
+		if cs.re, err = regexp.Compile(s.Regexp); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// text returns the cleaned up text of the selected node,
+// or the empty string if not found.
+func (cs *compiledSelector) text(doc *goquery.Document) string {
+	nodes := doc.FindMatcher(cs.sel)
+	if cs.nth >= nodes.Length() {
+		return ""
+	}
+	text := strings.TrimSpace(nodes.Eq(cs.nth).Text())
+	if cs.re == nil {
+		return text
+	}
+	m := cs.re.FindStringSubmatch(text)
+	switch len(m) {
+	case 0:
+		return ""
+	case 1:
+		return strings.TrimSpace(m[0])
+	}
+	return strings.TrimSpace(m[1])
+}
+
+// Compile checks the scraper definition and returns its parse function.
+func (s *SelectorScraper) Compile() (ParseFunc, error) {
+	price, err := s.Price.compile()
+	if err != nil {
+		return nil, fmt.Errorf("Price: %s", err)
+	}
+	date, err := s.Date.compile()
+	if err != nil {
+		return nil, fmt.Errorf("Date: %s", err)
+	}
+	if s.DateLayout == "" {
+		return nil, errors.New("Date layout cannot be empty")
+	}
+	tz := s.TimeZone
+	if tz == "" {
+		tz = defaultTimeZone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := s.DateLayout
+	return func(doc *goquery.Document) (*Result, error) {
+		res := &Result{
+			PriceStr: price.text(doc),
+			DateStr:  date.text(doc),
+		}
+		var err error
+		if res.Price, err = parsePrice(res.PriceStr); err != nil {
+			return nil, err
+		}
+		if res.DateStr == "" {
+			return nil, errors.New("Date not found")
+		}
+		if res.Date, err = time.ParseInLocation(layout, res.DateStr, loc); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}, nil
+}
+
+// RegisterSelectorScraper compiles the scraper definition and makes
+// the scraper available by name, as RegisterScraper does.
+// It replaces a scraper already registered with the same name,
+// e.g. a builtin scraper whose site changed its layout.
+func RegisterSelectorScraper(name string, hosts []string, def *SelectorScraper) error {
+	fn, err := def.Compile()
+	if err != nil {
+		return fmt.Errorf("%s: scraper=%q", err, name)
+	}
+	return register(name, hosts, &registeredScraper{parse: fn}, true)
+}
@@ -0,0 +1,92 @@
+package run
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const selectorTestPage = `
+<table class="overviewKeyStatsTable">
+  <tr><td class="line heading">NAV<span class="heading"><br />27/01/2017</span></td>
+      <td class="line"> </td>
+      <td class="line text">EUR 5,158</td></tr>
+  <tr><td class="line heading">Var.Ultima Quotazione</td>
+      <td class="line"> </td>
+      <td class="line text">-0,04%</td></tr>
+</table>`
+
+func TestSelectorScraper(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(selectorTestPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := &SelectorScraper{
+		Price:      Selector{CSS: "td.text", Regexp: `EUR\s+(\S+)`},
+		Date:       Selector{CSS: "td.heading span", Nth: 0},
+		DateLayout: "02/01/2006",
+		TimeZone:   "UTC",
+	}
+	parse, err := def.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PriceStr != "5,158" || res.Price != 5.158 {
+		t.Errorf("price: expected 5,158, found %q %v", res.PriceStr, res.Price)
+	}
+	if date := time.Date(2017, 1, 27, 0, 0, 0, 0, time.UTC); !res.Date.Equal(date) {
+		t.Errorf("date: expected %v, found %v", date, res.Date)
+	}
+
+	// nth node not found
+	def.Price.Nth = 2
+	parse, _ = def.Compile()
+	if _, err := parse(doc); err == nil {
+		t.Error("expected price not found")
+	}
+}
+
+func TestSelectorScraperCompile(t *testing.T) {
+	valid := Selector{CSS: "td"}
+	testCases := map[string]*SelectorScraper{
+		"empty":    {Price: Selector{}, Date: valid, DateLayout: "02/01/2006"},
+		"css":      {Price: Selector{CSS: "td["}, Date: valid, DateLayout: "02/01/2006"},
+		"nth":      {Price: Selector{CSS: "td", Nth: -1}, Date: valid, DateLayout: "02/01/2006"},
+		"regexp":   {Price: Selector{CSS: "td", Regexp: "("}, Date: valid, DateLayout: "02/01/2006"},
+		"layout":   {Price: valid, Date: valid},
+		"timezone": {Price: valid, Date: valid, DateLayout: "02/01/2006", TimeZone: "Nowhere/City"},
+	}
+	for name, def := range testCases {
+		if _, err := def.Compile(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRegisterSelectorScraper(t *testing.T) {
+	def := &SelectorScraper{Price: Selector{CSS: "td"}, Date: Selector{CSS: "td"}, DateLayout: "02/01/2006"}
+
+	// the scraper is replaced, hosts included
+	for _, host := range []string{"selector.test", "www.selector.test"} {
+		if err := RegisterSelectorScraper("test.selector", []string{host}, def); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := GetScraperFromUrl("http://selector.test/"); err == nil {
+		t.Error("expected old host not found")
+	}
+	if name, err := GetScraperFromUrl("http://www.selector.test/"); name != "test.selector" || err != nil {
+		t.Errorf("expected test.selector, found %q (%v)", name, err)
+	}
+
+	// the hosts of other scrapers cannot be taken
+	if err := RegisterSelectorScraper("test.selector", []string{"quotes.test"}, def); err == nil {
+		t.Error("expected error for host of another scraper")
+	}
+}
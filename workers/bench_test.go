@@ -0,0 +1,134 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// benchRequests returns the requests of n jobs,
+// each one with 1 to 3 sources among 3 workers.
+func benchRequests(n int) []Request {
+	requests := make([]Request, 0, 2*n)
+	for j := 0; j < n; j++ {
+		jid := fmt.Sprintf("job_%d", j)
+		for w := 0; w <= j%3; w++ {
+			wid := fmt.Sprintf("worker_%d", (j+w)%3+1)
+			requests = append(requests, &testRequest{jobid: jid, workerid: wid})
+		}
+	}
+	return requests
+}
+
+var benchSizes = []int{10000, 100000}
+
+func BenchmarkDistribute(b *testing.B) {
+	for _, n := range benchSizes {
+		requests := benchRequests(n)
+		b.Run(fmt.Sprintf("jobs=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				distribute(requests)
+			}
+		})
+	}
+}
+
+func BenchmarkDistributeLegacy(b *testing.B) {
+	for _, n := range benchSizes {
+		requests := benchRequests(n)
+		b.Run(fmt.Sprintf("jobs=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				legacyDistribute(groupByWorker(requests))
+			}
+		})
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	work := func(ctx context.Context, req Request) Response {
+		treq := req.(*testRequest)
+		return &testResponse{jobid: treq.jobid, workerid: treq.workerid}
+	}
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 10, Work: work},
+		{WorkerID: "worker_2", Instances: 10, Work: work},
+		{WorkerID: "worker_3", Instances: 10, Work: work},
+	}
+	for _, n := range benchSizes {
+		requests := benchRequests(n)
+		b.Run(fmt.Sprintf("jobs=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				out, err := Execute(context.Background(), workers, requests)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for range out {
+				}
+			}
+		})
+	}
+}
+
+// legacyDistribute is the previous implementation of distribute,
+// rebuilding and sorting the jobs at each pass, and removing each request
+// with a linear scan of the worker list: O(n²) in the number of requests.
+func legacyDistribute(src mapWorkerRequests) {
+	type jobInfo struct {
+		jobkey  JobKey
+		workers int
+	}
+
+	jobWorkers := func() map[JobKey][]WorkerKey {
+		jw := map[JobKey][]WorkerKey{}
+		for wid, reqs := range src {
+			for _, r := range reqs {
+				jw[r.JobID()] = append(jw[r.JobID()], wid)
+			}
+		}
+		return jw
+	}
+	jobOrder := func(jw map[JobKey][]WorkerKey) []JobKey {
+		list := make([]jobInfo, 0, len(jw))
+		for jid, wids := range jw {
+			list = append(list, jobInfo{jid, len(wids)})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].workers < list[j].workers })
+		a := make([]JobKey, 0, len(jw))
+		for _, ji := range list {
+			a = append(a, ji.jobkey)
+		}
+		return a
+	}
+
+	dst := mapWorkerRequests{}
+	for {
+		jw := jobWorkers()
+		ord := jobOrder(jw)
+		if len(ord) == 0 {
+			break
+		}
+		for _, jid := range ord {
+			wids := jw[jid]
+			var minlen, minidx int
+			for idx, wid := range wids {
+				if l := len(dst[wid]); idx == 0 || l < minlen {
+					minlen, minidx = l, idx
+				}
+			}
+			wid := wids[minidx]
+			reqs := src[wid]
+			for idx, req := range reqs {
+				if req.JobID() == jid {
+					dst[wid] = append(dst[wid], req)
+					reqs[idx] = reqs[len(reqs)-1]
+					src[wid] = reqs[:len(reqs)-1]
+					break
+				}
+			}
+		}
+	}
+	for wid := range src {
+		src[wid] = dst[wid]
+	}
+}
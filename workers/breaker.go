@@ -0,0 +1,207 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// default number of responses used to compute the failure rate
+const defaultBreakerWindow = 20
+
+// ErrCircuitOpen is the error of the requests not worked
+// because the circuit breaker of the worker is open.
+var ErrCircuitOpen = errors.New("Circuit open")
+
+// TaskError is the Response of a request not worked by the Pool.
+type TaskError struct {
+	Request Request
+	Err     error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("%s: worker=%q, job=%q", e.Err, e.Request.WorkerID(), e.Request.JobID())
+}
+func (e *TaskError) Unwrap() error { return e.Err }
+
+// Success always returns false.
+func (e *TaskError) Success() bool { return false }
+
+// CircuitBreaker is the circuit breaker policy of a worker.
+// When the circuit is open, the requests of the worker fail at once
+// with a *TaskError wrapping ErrCircuitOpen.
+// The zero value means no circuit breaker.
+type CircuitBreaker struct {
+	// ConsecutiveFailures opens the circuit after the given number
+	// of consecutive failed requests. Zero means no limit.
+	ConsecutiveFailures int
+	// FailureRate opens the circuit when the rate of the failed requests,
+	// among the last Window ones, is above the threshold (0..1).
+	// Zero means no limit.
+	FailureRate float64
+	// Window is the number of requests used to compute the failure rate.
+	// Zero means 20.
+	Window int
+	// OpenTimeout, if positive, is the time after which an open circuit
+	// becomes half-open: a single probe request is worked,
+	// closing the circuit if it succeeds or opening it again otherwise.
+	// Zero means the circuit stays open.
+	OpenTimeout time.Duration
+}
+
+func (cb *CircuitBreaker) check() error {
+	if cb.ConsecutiveFailures < 0 {
+		return fmt.Errorf("CircuitBreaker.ConsecutiveFailures cannot be negative: %d", cb.ConsecutiveFailures)
+	}
+	if cb.FailureRate < 0 || cb.FailureRate > 1 {
+		return fmt.Errorf("CircuitBreaker.FailureRate must be in 0..1 range: %v", cb.FailureRate)
+	}
+	if cb.Window < 0 {
+		return fmt.Errorf("CircuitBreaker.Window cannot be negative: %d", cb.Window)
+	}
+	if cb.OpenTimeout < 0 {
+		return fmt.Errorf("CircuitBreaker.OpenTimeout cannot be negative: %v", cb.OpenTimeout)
+	}
+	return nil
+}
+
+func (cb *CircuitBreaker) enabled() bool {
+	return cb.ConsecutiveFailures > 0 || cb.FailureRate > 0
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker tracks the responses of a worker.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	policy      CircuitBreaker
+	state       circuitState
+	openedAt    time.Time
+	probing     bool
+	consecutive int    // consecutive failures
+	results     []bool // ring of the last results: true in case of failure
+	next        int    // index of the oldest item of results
+	failures    int    // failures in results
+}
+
+func newCircuitBreaker(policy CircuitBreaker) *circuitBreaker {
+	if policy.Window == 0 {
+		policy.Window = defaultBreakerWindow
+	}
+	return &circuitBreaker{policy: policy}
+}
+
+// allow reports whether a request can be worked,
+// and if it is the probe request of a half-open circuit.
+func (cb *circuitBreaker) allow(now time.Time) (ok, probe bool) {
+	if !cb.policy.enabled() {
+		return true, false
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if cb.policy.OpenTimeout <= 0 || now.Sub(cb.openedAt) < cb.policy.OpenTimeout {
+			return false, false
+		}
+		cb.state = circuitHalfOpen
+		fallthrough
+	case circuitHalfOpen:
+		if cb.probing {
+			return false, false
+		}
+		cb.probing = true
+		return true, true
+	}
+	return true, false
+}
+
+// record updates the state of the circuit with the result of a request.
+func (cb *circuitBreaker) record(now time.Time, success, probe bool) {
+	if !cb.policy.enabled() {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitHalfOpen:
+		if !probe {
+			return
+		}
+		cb.probing = false
+		if success {
+			cb.reset()
+		} else {
+			cb.open(now)
+		}
+	case circuitClosed:
+		cb.add(!success)
+		if cb.trip() {
+			cb.open(now)
+		}
+	}
+}
+
+// release frees the probe slot of a request cancelled before its result.
+func (cb *circuitBreaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	cb.mu.Lock()
+	cb.probing = false
+	cb.mu.Unlock()
+}
+
+func (cb *circuitBreaker) add(failure bool) {
+	if failure {
+		cb.consecutive++
+	} else {
+		cb.consecutive = 0
+	}
+	if len(cb.results) < cb.policy.Window {
+		cb.results = append(cb.results, failure)
+	} else {
+		if cb.results[cb.next] {
+			cb.failures--
+		}
+		cb.results[cb.next] = failure
+		cb.next = (cb.next + 1) % cb.policy.Window
+	}
+	if failure {
+		cb.failures++
+	}
+}
+
+// trip reports whether the circuit must be opened.
+func (cb *circuitBreaker) trip() bool {
+	p := &cb.policy
+	if p.ConsecutiveFailures > 0 && cb.consecutive >= p.ConsecutiveFailures {
+		return true
+	}
+	if p.FailureRate > 0 && len(cb.results) == p.Window {
+		return float64(cb.failures)/float64(p.Window) > p.FailureRate
+	}
+	return false
+}
+
+func (cb *circuitBreaker) open(now time.Time) {
+	cb.state = circuitOpen
+	cb.openedAt = now
+}
+
+func (cb *circuitBreaker) reset() {
+	cb.state = circuitClosed
+	cb.consecutive = 0
+	cb.results = cb.results[:0]
+	cb.next = 0
+	cb.failures = 0
+}
@@ -0,0 +1,132 @@
+package workers
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+
+	cb := newCircuitBreaker(CircuitBreaker{ConsecutiveFailures: 3, OpenTimeout: time.Minute})
+	allow := func(now time.Time, expectOk, expectProbe bool) bool {
+		ok, probe := cb.allow(now)
+		if ok != expectOk || probe != expectProbe {
+			t.Errorf("allow: expected (%v, %v), found (%v, %v)", expectOk, expectProbe, ok, probe)
+		}
+		return probe
+	}
+
+	// a success resets the consecutive failures
+	for _, success := range []bool{false, false, true, false, false} {
+		allow(t0, true, false)
+		cb.record(t0, success, false)
+	}
+	// third consecutive failure: open
+	allow(t0, true, false)
+	cb.record(t0, false, false)
+	allow(t0, false, false)
+	allow(t0.Add(59*time.Second), false, false)
+
+	// half-open: a single probe at a time
+	probe := allow(t0.Add(time.Minute), true, true)
+	allow(t0.Add(time.Minute), false, false)
+	// a cancelled probe frees the slot
+	cb.release(probe)
+	probe = allow(t0.Add(time.Minute), true, true)
+	// probe failed: open again
+	cb.record(t0.Add(time.Minute), false, probe)
+	allow(t0.Add(time.Minute+time.Second), false, false)
+
+	// probe succeeded: closed
+	probe = allow(t0.Add(2*time.Minute), true, true)
+	cb.record(t0.Add(2*time.Minute), true, probe)
+	allow(t0.Add(2*time.Minute), true, false)
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(CircuitBreaker{FailureRate: 0.5, Window: 4})
+
+	// rate computed only on a full window
+	for _, success := range []bool{false, false, false, true} {
+		if ok, _ := cb.allow(t0); !ok {
+			t.Fatal("circuit open before the window is full")
+		}
+		cb.record(t0, success, false)
+	}
+	// 3 failures out of 4
+	if ok, _ := cb.allow(t0); ok {
+		t.Error("expected open circuit")
+	}
+	// no half-open without OpenTimeout
+	if ok, _ := cb.allow(t0.Add(time.Hour)); ok {
+		t.Error("expected open circuit")
+	}
+}
+
+func TestCircuitBreakerExecute(t *testing.T) {
+	var calls1 int32
+	workers := []*Worker{
+		{
+			WorkerID:       "worker_1",
+			Instances:      1,
+			Work:           countingWork(100, &calls1),
+			CircuitBreaker: CircuitBreaker{ConsecutiveFailures: 2},
+		},
+		{WorkerID: "worker_2", Instances: 1, Work: sleepWork(time.Millisecond, false)},
+	}
+	var requests []Request
+	for _, jid := range []string{"job_1", "job_2", "job_3", "job_4", "job_5"} {
+		requests = append(requests, &testRequest{jobid: jid, workerid: "worker_1"})
+	}
+	// job_6 has a single source
+	requests = append(requests, &testRequest{jobid: "job_6", workerid: "worker_1"})
+	for _, jid := range []string{"job_1", "job_2", "job_3", "job_4", "job_5"} {
+		requests = append(requests, &testRequest{jobid: jid, workerid: "worker_2"})
+	}
+
+	res := executeAll(t, workers, requests, Hedge(HedgePolicy{Delay: time.Hour}))
+
+	if n := atomic.LoadInt32(&calls1); n != 2 {
+		t.Errorf("worker_1 calls: expected 2, found %d", n)
+	}
+	for _, r := range res {
+		if te, ok := r.(*TaskError); ok {
+			if te.Request.JobID() != "job_6" || !errors.Is(te, ErrCircuitOpen) {
+				t.Errorf("unexpected error %v", te)
+			}
+			continue
+		}
+		if !r.Success() {
+			t.Errorf("unexpected failure %v", r)
+		}
+	}
+}
+
+func TestCircuitBreakerNeutral(t *testing.T) {
+	var calls int32
+	workers := []*Worker{{
+		WorkerID:       "worker_1",
+		Instances:      1,
+		Work:           countingWork(100, &calls),
+		CircuitBreaker: CircuitBreaker{ConsecutiveFailures: 1},
+		Neutral:        func(Response) bool { return true },
+	}}
+	var requests []Request
+	for _, jid := range []string{"job_1", "job_2", "job_3"} {
+		requests = append(requests, &testRequest{jobid: jid, workerid: "worker_1"})
+	}
+
+	// the neutral failures don't open the circuit
+	for _, r := range executeAll(t, workers, requests) {
+		if _, ok := r.(*TaskError); ok {
+			t.Errorf("unexpected error %v", r)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, found %d", calls)
+	}
+}
@@ -0,0 +1,90 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// causeWork waits for the cancellation of the request,
+// and returns its cause as the response error.
+func causeWork(ctx context.Context, req Request) Response {
+	<-ctx.Done()
+	return &testResponse{jobid: string(req.JobID()), workerid: string(req.WorkerID()), err: context.Cause(ctx)}
+}
+
+// causeObserver records the cause of the cancelled tasks.
+type causeObserver struct {
+	NopObserver
+	causes chan error
+}
+
+func (o *causeObserver) TaskCancelled(ev TaskEvent) { o.causes <- ev.Cause }
+
+func TestCancelCause(t *testing.T) {
+	testCases := map[string]struct {
+		workers []*Worker
+		opts    []Option
+		cancel  time.Duration // cancel the run after the delay, if positive
+		cause   error
+	}{
+		"sibling": {
+			workers: []*Worker{
+				{WorkerID: "worker_1", Instances: 1, Work: causeWork},
+				{WorkerID: "worker_2", Instances: 1, Work: sleepWork(10*time.Millisecond, false)},
+			},
+			cause: ErrSiblingSucceeded,
+		},
+		"timeout": {
+			workers: []*Worker{
+				{WorkerID: "worker_1", Instances: 1, Work: causeWork},
+				{WorkerID: "worker_2", Instances: 1, Work: causeWork},
+			},
+			opts:  []Option{JobTimeout(10 * time.Millisecond)},
+			cause: ErrJobTimeout,
+		},
+		"run": {
+			workers: []*Worker{
+				{WorkerID: "worker_1", Instances: 1, Work: causeWork},
+				{WorkerID: "worker_2", Instances: 1, Work: causeWork},
+			},
+			cancel: 10 * time.Millisecond,
+			cause:  ErrRunCancelled,
+		},
+	}
+
+	for name, tc := range testCases {
+		requests := []Request{
+			&testRequest{jobid: "job_1", workerid: "worker_1"},
+			&testRequest{jobid: "job_1", workerid: "worker_2"},
+		}
+		obs := &causeObserver{causes: make(chan error, len(requests))}
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.cancel > 0 {
+			time.AfterFunc(tc.cancel, cancel)
+		}
+		out, err := ExecuteVerbose(ctx, tc.workers, requests, append(tc.opts, Observe(obs))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := <-out
+		for range out {
+		}
+		cancel()
+
+		// the attempt of worker_1, always cancelled
+		var found error
+		for _, a := range res.Attempts {
+			if a.Request.WorkerID() == "worker_1" {
+				found = a.Cause
+			}
+		}
+		if !errors.Is(found, tc.cause) {
+			t.Errorf("%s: expected attempt cause %v, found %v", name, tc.cause, found)
+		}
+		if found := <-obs.causes; !errors.Is(found, tc.cause) {
+			t.Errorf("%s: expected event cause %v, found %v", name, tc.cause, found)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of a Pool.
+// It can be replaced, e.g. by a virtual clock in simulations.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc waits for the duration to elapse and then calls f.
+	// The returned Timer can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer of a Clock.
+type Timer interface {
+	// Stop prevents the Timer from firing.
+	// It returns false if the timer has already fired or been stopped.
+	Stop() bool
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// since returns the time elapsed since t.
+func since(c Clock, t time.Time) time.Duration { return c.Now().Sub(t) }
+
+// sleep waits for the duration.
+// It returns the context error if the context is done before.
+func sleep(ctx context.Context, c Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	done := make(chan struct{})
+	timer := c.AfterFunc(d, func() { close(done) })
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// withTimeout is like context.WithTimeout, using the clock.
+func withTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := c.(realClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	inner, cancel := context.WithCancelCause(ctx)
+	tc := &timeoutCtx{Context: inner, deadline: c.Now().Add(d), done: make(chan struct{})}
+	context.AfterFunc(inner, tc.close)
+	timer := c.AfterFunc(d, func() { cancel(context.DeadlineExceeded) })
+	return tc, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+		tc.close()
+	}
+}
+
+// timeoutCtx is the context of withTimeout with a virtual clock.
+// Like the context of context.WithTimeout, its Err is
+// context.DeadlineExceeded once the deadline expires.
+// It has its own Done channel, so that the contexts derived from it
+// are cancelled with its Err.
+type timeoutCtx struct {
+	context.Context // cancelled with the DeadlineExceeded cause when expired
+	deadline        time.Time
+	done            chan struct{}
+	once            sync.Once
+}
+
+func (c *timeoutCtx) close() { c.once.Do(func() { close(c.done) }) }
+
+func (c *timeoutCtx) Deadline() (time.Time, bool) {
+	if d, ok := c.Context.Deadline(); ok && d.Before(c.deadline) {
+		return d, true
+	}
+	return c.deadline, true
+}
+
+func (c *timeoutCtx) Done() <-chan struct{} { return c.done }
+
+func (c *timeoutCtx) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+	if errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// randSource is a source of random numbers safe for concurrent use.
+// The nil source uses the global source of math/rand.
+type randSource struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newRandSource(seed int64) *randSource {
+	return &randSource{r: rand.New(rand.NewSource(seed))}
+}
+
+func (s *randSource) int63n(n int64) int64 {
+	if s == nil {
+		return rand.Int63n(n)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63n(n)
+}
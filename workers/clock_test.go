@@ -0,0 +1,109 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock whose time is moved by advance.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	clock *manualClock
+	when  time.Time
+	f     func()
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, x := range c.timers {
+		if x == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// advance moves the time forward, firing the expired timers.
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var expired []*manualTimer
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			timers = append(timers, t)
+		} else {
+			expired = append(expired, t)
+		}
+	}
+	c.timers = timers
+	c.mu.Unlock()
+	for _, t := range expired {
+		t.f()
+	}
+}
+
+func TestWithTimeoutClock(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	clock := &manualClock{now: t0}
+
+	// expired: the same errors of the real clock, for the derived contexts too
+	ctx, cancel := withTimeout(context.Background(), clock, time.Second)
+	defer cancel()
+	child, cancelChild := context.WithCancel(ctx)
+	defer cancelChild()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(t0.Add(time.Second)) {
+		t.Errorf("expected deadline %v, found %v", t0.Add(time.Second), d)
+	}
+	if err := ctx.Err(); err != nil {
+		t.Errorf("expected nil error, found %v", err)
+	}
+	clock.advance(time.Second)
+	<-child.Done()
+	if ctx.Err() != context.DeadlineExceeded || child.Err() != context.DeadlineExceeded {
+		t.Errorf("expected %v, found %v and %v", context.DeadlineExceeded, ctx.Err(), child.Err())
+	}
+
+	// cancelled before the deadline
+	ctx, cancel = withTimeout(context.Background(), clock, time.Second)
+	cancel()
+	<-ctx.Done()
+	if err := ctx.Err(); err != context.Canceled {
+		t.Errorf("expected %v, found %v", context.Canceled, err)
+	}
+
+	// parent cancelled
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = withTimeout(parent, clock, time.Second)
+	defer cancel()
+	cancelParent()
+	<-ctx.Done()
+	clock.advance(time.Second)
+	if err := ctx.Err(); err != context.Canceled {
+		t.Errorf("expected %v, found %v", context.Canceled, err)
+	}
+}
@@ -10,15 +10,15 @@ type requests []string
 type workerRequests map[string]requests
 type jobWorkers map[string][]string
 
-type jobInfo struct {
+type jobItem struct {
 	job     string
 	workers int
 }
-type byLen []jobInfo
+type byWorkers []jobItem
 
-func (a byLen) Len() int           { return len(a) }
-func (a byLen) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byLen) Less(i, j int) bool { return a[i].workers < a[j].workers }
+func (a byWorkers) Len() int           { return len(a) }
+func (a byWorkers) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byWorkers) Less(i, j int) bool { return a[i].workers < a[j].workers }
 
 func a2s(a []string) string {
 	return "[" + strings.Join(a, ", ") + "]"
@@ -72,11 +72,11 @@ func (wr workerRequests) jobWorkers() jobWorkers {
 }
 
 func (jw jobWorkers) order() []string {
-	var m = make([]jobInfo, 0, len(jw))
+	var m = make([]jobItem, 0, len(jw))
 	for j, w := range jw {
-		m = append(m, jobInfo{j, len(w)})
+		m = append(m, jobItem{j, len(w)})
 	}
-	sort.Sort(byLen(m))
+	sort.Sort(byWorkers(m))
 	a := make([]string, 0, len(jw))
 	for _, i := range m {
 		a = append(a, i.job)
@@ -0,0 +1,139 @@
+package workers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// default min number of latencies observed
+// before using the quantile based hedging delay
+const defaultHedgeMinSamples = 10
+
+// number of latencies kept for each worker
+const maxLatencySamples = 100
+
+// HedgePolicy is the policy of the hedging mode.
+//
+// In hedging mode only the first request of each job is started.
+// The next request of the job is started when the previous one fails,
+// or when it doesn't respond within the hedging delay.
+type HedgePolicy struct {
+	// Delay is the time waited for a response
+	// before starting the next request of the job.
+	Delay time.Duration
+	// Quantile, if positive, replaces Delay with the given quantile
+	// (e.g. 0.95) of the latencies observed for the worker of the request.
+	Quantile float64
+	// MinSamples is the number of latencies to be observed for a worker
+	// before using the Quantile. Until then, Delay is used.
+	// Zero means 10.
+	MinSamples int
+}
+
+func (hp *HedgePolicy) check() error {
+	if hp.Delay < 0 {
+		return fmt.Errorf("HedgePolicy.Delay cannot be negative: %v", hp.Delay)
+	}
+	if hp.Quantile < 0 || hp.Quantile > 1 {
+		return fmt.Errorf("HedgePolicy.Quantile must be in 0..1 range: %v", hp.Quantile)
+	}
+	if hp.MinSamples < 0 {
+		return fmt.Errorf("HedgePolicy.MinSamples cannot be negative: %d", hp.MinSamples)
+	}
+	return nil
+}
+
+// delay returns the hedging delay of a request of the worker.
+func (hp *HedgePolicy) delay(w *workerContextItem) time.Duration {
+	if hp.Quantile > 0 {
+		minSamples := hp.MinSamples
+		if minSamples == 0 {
+			minSamples = defaultHedgeMinSamples
+		}
+		if d, ok := w.latencies.quantile(hp.Quantile, minSamples); ok {
+			return d
+		}
+	}
+	return hp.Delay
+}
+
+// latencyTracker keeps the last latencies of the successful requests
+// of a worker.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (lt *latencyTracker) add(d time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if len(lt.samples) < maxLatencySamples {
+		lt.samples = append(lt.samples, d)
+		return
+	}
+	lt.samples[lt.next] = d
+	lt.next = (lt.next + 1) % maxLatencySamples
+}
+
+// quantile returns the q-quantile of the latencies.
+// It returns false if less than minSamples latencies have been observed.
+func (lt *latencyTracker) quantile(q float64, minSamples int) (time.Duration, bool) {
+	lt.mu.Lock()
+	a := make([]time.Duration, len(lt.samples))
+	copy(a, lt.samples)
+	lt.mu.Unlock()
+
+	if len(a) == 0 || len(a) < minSamples {
+		return 0, false
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	idx := int(q*float64(len(a))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	} else if idx >= len(a) {
+		idx = len(a) - 1
+	}
+	return a[idx], true
+}
+
+// release starts the next pending request of the job, if any.
+// The task is put at the start of the worker queue,
+// since the job is already in progress.
+func (p *Pool) release(jc *jobContextItem) {
+	if jc.ctx.Err() != nil {
+		return
+	}
+	jc.mu.Lock()
+	if len(jc.pending) == 0 {
+		jc.mu.Unlock()
+		return
+	}
+	req := jc.pending[0]
+	jc.pending = jc.pending[1:]
+	t := jc.newTask(req)
+	jc.mu.Unlock()
+
+	p.opts.observers.taskQueued(req)
+	p.queues[req.WorkerID()].pushFront(t)
+}
+
+// hedge starts the hedging timer of the task.
+// The returned function must be called with the response of the task:
+// in case of failure, or of success in quorum mode,
+// the next request is started at once.
+// Each task starts at most one other request.
+func (p *Pool) hedge(w *workerContextItem, t *task) func(Response) {
+	var once sync.Once
+	next := func() { once.Do(func() { p.release(t.job) }) }
+
+	timer := p.opts.clock.AfterFunc(p.opts.hedge.delay(w), next)
+	return func(res Response) {
+		timer.Stop()
+		if !res.Success() || p.opts.quorum > 1 {
+			next()
+		}
+	}
+}
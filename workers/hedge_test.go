@@ -0,0 +1,97 @@
+package workers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countedWork wraps fn counting its calls in *calls.
+func countedWork(fn WorkFunc, calls *int32) WorkFunc {
+	return func(ctx context.Context, req Request) Response {
+		atomic.AddInt32(calls, 1)
+		return fn(ctx, req)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	testCases := []struct {
+		name    string
+		work1   WorkFunc
+		delay   time.Duration
+		worker  string // worker of the expected response
+		calls2  int32
+		maxTime time.Duration
+	}{
+		{"first in time", sleepWork(ms(10), false), ms(500), "worker_1", 0, ms(400)},
+		{"first too slow", sleepWork(ms(2000), false), ms(50), "worker_2", 1, ms(1000)},
+		{"first failed", sleepWork(ms(10), true), time.Hour, "worker_2", 1, ms(1000)},
+	}
+
+	for _, tc := range testCases {
+		var calls2 int32
+		workers := []*Worker{
+			{WorkerID: "worker_1", Instances: 1, Work: tc.work1},
+			{WorkerID: "worker_2", Instances: 1, Work: countedWork(sleepWork(ms(10), false), &calls2)},
+		}
+		requests := []Request{
+			&testRequest{jobid: "job_1", workerid: "worker_1"},
+			&testRequest{jobid: "job_1", workerid: "worker_2"},
+		}
+
+		start := time.Now()
+		res := executeAll(t, workers, requests, Hedge(HedgePolicy{Delay: tc.delay}))
+		elapsed := time.Since(start)
+
+		if len(res) != 1 {
+			t.Fatalf("[%s] expected 1 response, found %d", tc.name, len(res))
+		}
+		if tres := res[0].(*testResponse); tres.workerid != tc.worker {
+			t.Errorf("[%s] expected response from %s, found %s", tc.name, tc.worker, tres.workerid)
+		}
+		if n := atomic.LoadInt32(&calls2); n != tc.calls2 {
+			t.Errorf("[%s] worker_2 calls: expected %d, found %d", tc.name, tc.calls2, n)
+		}
+		if elapsed > tc.maxTime {
+			t.Errorf("[%s] elapsed %v, expected less than %v", tc.name, elapsed, tc.maxTime)
+		}
+	}
+}
+
+func TestLatencyQuantile(t *testing.T) {
+	var lt latencyTracker
+
+	if _, ok := lt.quantile(0.95, 1); ok {
+		t.Error("expected no quantile without samples")
+	}
+	for j := 1; j <= 100; j++ {
+		lt.add(time.Duration(j) * time.Millisecond)
+	}
+	if _, ok := lt.quantile(0.95, 200); ok {
+		t.Error("expected no quantile with less than min samples")
+	}
+	testCases := []struct {
+		q      float64
+		expect time.Duration
+	}{
+		{0.5, 50 * time.Millisecond},
+		{0.95, 95 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		if got, _ := lt.quantile(tc.q, 10); got != tc.expect {
+			t.Errorf("quantile(%v): expected %v, found %v", tc.q, tc.expect, got)
+		}
+	}
+
+	// the oldest samples are replaced
+	for j := 0; j < 100; j++ {
+		lt.add(time.Second)
+	}
+	if got, _ := lt.quantile(0.5, 10); got != time.Second {
+		t.Errorf("quantile(0.5): expected %v, found %v", time.Second, got)
+	}
+}
@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"context"
+	"sync"
+)
+
+// inflightLimiter limits the number of tasks worked at the same time
+// by all the workers of a Pool. A free slot goes to the waiting worker
+// with fewer tasks in flight, so that no worker starves the others.
+// The nil limiter has no limit.
+type inflightLimiter struct {
+	mu       sync.Mutex
+	max      int
+	running  int
+	byWorker map[WorkerKey]int // tasks in flight of each worker
+	waiters  []*inflightWaiter // in arrival order
+}
+
+type inflightWaiter struct {
+	wid     WorkerKey
+	ready   chan struct{}
+	granted bool
+}
+
+func newInflightLimiter(max int) *inflightLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &inflightLimiter{max: max, byWorker: map[WorkerKey]int{}}
+}
+
+// acquire waits for a free slot for a task of the worker.
+// It returns the context error if the context is done before.
+func (l *inflightLimiter) acquire(ctx context.Context, wid WorkerKey) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.running < l.max && len(l.waiters) == 0 {
+		l.running++
+		l.byWorker[wid]++
+		l.mu.Unlock()
+		return nil
+	}
+	w := &inflightWaiter{wid: wid, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	if w.granted {
+		// the slot was granted in the meantime: give it back
+		l.mu.Unlock()
+		l.release(wid)
+		return ctx.Err()
+	}
+	for j, x := range l.waiters {
+		if x == w {
+			l.waiters = append(l.waiters[:j], l.waiters[j+1:]...)
+			break
+		}
+	}
+	l.mu.Unlock()
+	return ctx.Err()
+}
+
+// release frees the slot of a task of the worker,
+// granting it to the waiting worker with fewer tasks in flight.
+func (l *inflightLimiter) release(wid WorkerKey) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.running--
+	l.byWorker[wid]--
+	if len(l.waiters) == 0 {
+		return
+	}
+	next := 0
+	for j, w := range l.waiters {
+		if l.byWorker[w.wid] < l.byWorker[l.waiters[next].wid] {
+			next = j
+		}
+	}
+	w := l.waiters[next]
+	l.waiters = append(l.waiters[:next], l.waiters[next+1:]...)
+	l.running++
+	l.byWorker[w.wid]++
+	w.granted = true
+	close(w.ready)
+}
@@ -0,0 +1,97 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInflightLimiterFair(t *testing.T) {
+	ctx := context.Background()
+	l := newInflightLimiter(2)
+	for j := 0; j < 2; j++ {
+		if err := l.acquire(ctx, "worker_1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// worker_1 waits before worker_2
+	granted := make(chan WorkerKey, 2)
+	for _, wid := range []WorkerKey{"worker_1", "worker_2"} {
+		go func(wid WorkerKey) {
+			l.acquire(ctx, wid)
+			granted <- wid
+		}(wid)
+		for waiting := false; !waiting; {
+			time.Sleep(time.Millisecond)
+			l.mu.Lock()
+			n := len(l.waiters)
+			waiting = n > 0 && l.waiters[n-1].wid == wid
+			l.mu.Unlock()
+		}
+	}
+
+	// worker_2 has no task in flight, so it gets the first free slot
+	l.release("worker_1")
+	if wid := <-granted; wid != "worker_2" {
+		t.Errorf("expected slot to worker_2, found %s", wid)
+	}
+	l.release("worker_1")
+	if wid := <-granted; wid != "worker_1" {
+		t.Errorf("expected slot to worker_1, found %s", wid)
+	}
+}
+
+func TestInflightLimiterCancel(t *testing.T) {
+	l := newInflightLimiter(1)
+	if err := l.acquire(context.Background(), "worker_1"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx, "worker_2"); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, found %v", context.DeadlineExceeded, err)
+	}
+	l.release("worker_1")
+	if l.running != 0 || len(l.waiters) != 0 {
+		t.Errorf("expected free limiter, found %d running and %d waiters", l.running, len(l.waiters))
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	var mu sync.Mutex
+	var running, peak int
+	work := func(ctx context.Context, req Request) Response {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		res := sleepWork(10*time.Millisecond, false)(ctx, req)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return res
+	}
+
+	var workers []*Worker
+	var requests []Request
+	for w := 1; w <= 3; w++ {
+		wid := fmt.Sprintf("worker_%d", w)
+		workers = append(workers, &Worker{WorkerID: WorkerKey(wid), Instances: 3, Work: work})
+		for j := 1; j <= 4; j++ {
+			requests = append(requests, &testRequest{jobid: fmt.Sprintf("job_%d_%d", w, j), workerid: wid})
+		}
+	}
+
+	res := executeAll(t, workers, requests, MaxInFlight(2))
+	if len(res) != len(requests) {
+		t.Errorf("expected %d responses, found %d", len(requests), len(res))
+	}
+	if peak != 2 {
+		t.Errorf("expected 2 requests in flight at most, found %d", peak)
+	}
+}
@@ -0,0 +1,114 @@
+package workers
+
+import "time"
+
+// TaskEvent is an event of a request worked by a Pool.
+type TaskEvent struct {
+	// Time of the event.
+	Time time.Time
+	// Request of the task.
+	Request Request
+	// Instance is the index of the worker instance, in 0..Instances-1.
+	// It is -1 for the TaskQueued event.
+	Instance int
+	// Response of the task, if any.
+	Response Response
+	// Cause of the cancellation, for the TaskCancelled event:
+	// e.g. ErrSiblingSucceeded, ErrJobTimeout or ErrRunCancelled.
+	Cause error
+}
+
+// JobEvent is an event of a job submitted to a Pool.
+type JobEvent struct {
+	// Time of the event.
+	Time time.Time
+	// Job key.
+	Job JobKey
+	// Response of the job.
+	Response Response
+}
+
+// Observer receives the lifecycle events of the tasks and jobs of a Pool.
+// The methods are called synchronously by the goroutines of the Pool,
+// so they must be fast and safe for concurrent use.
+type Observer interface {
+	// TaskQueued is called when the task is put in the worker queue.
+	TaskQueued(TaskEvent)
+	// TaskStarted is called when a worker instance starts the task.
+	TaskStarted(TaskEvent)
+	// TaskFinished is called with the response of the task.
+	TaskFinished(TaskEvent)
+	// TaskCancelled is called when the task is skipped, or its response
+	// discarded, because the job context is done,
+	// e.g. because another request of the job succeeded.
+	TaskCancelled(TaskEvent)
+	// JobCompleted is called with the response of the job.
+	JobCompleted(JobEvent)
+}
+
+// NopObserver is an Observer that ignores all the events.
+// It can be embedded to implement only some of the Observer methods.
+type NopObserver struct{}
+
+func (NopObserver) TaskQueued(TaskEvent)    {}
+func (NopObserver) TaskStarted(TaskEvent)   {}
+func (NopObserver) TaskFinished(TaskEvent)  {}
+func (NopObserver) TaskCancelled(TaskEvent) {}
+func (NopObserver) JobCompleted(JobEvent)   {}
+
+// observers is the list of the observers of a Pool,
+// with the clock of the events.
+type observers struct {
+	list  []Observer
+	clock Clock
+}
+
+func (obs observers) taskQueued(req Request) {
+	if len(obs.list) == 0 {
+		return
+	}
+	ev := TaskEvent{Time: obs.clock.Now(), Request: req, Instance: -1}
+	for _, o := range obs.list {
+		o.TaskQueued(ev)
+	}
+}
+
+func (obs observers) taskStarted(req Request, instance int) {
+	if len(obs.list) == 0 {
+		return
+	}
+	ev := TaskEvent{Time: obs.clock.Now(), Request: req, Instance: instance}
+	for _, o := range obs.list {
+		o.TaskStarted(ev)
+	}
+}
+
+func (obs observers) taskFinished(req Request, instance int, res Response) {
+	if len(obs.list) == 0 {
+		return
+	}
+	ev := TaskEvent{Time: obs.clock.Now(), Request: req, Instance: instance, Response: res}
+	for _, o := range obs.list {
+		o.TaskFinished(ev)
+	}
+}
+
+func (obs observers) taskCancelled(req Request, instance int, res Response, cause error) {
+	if len(obs.list) == 0 {
+		return
+	}
+	ev := TaskEvent{Time: obs.clock.Now(), Request: req, Instance: instance, Response: res, Cause: cause}
+	for _, o := range obs.list {
+		o.TaskCancelled(ev)
+	}
+}
+
+func (obs observers) jobCompleted(job JobKey, res Response) {
+	if len(obs.list) == 0 {
+		return
+	}
+	ev := JobEvent{Time: obs.clock.Now(), Job: job, Response: res}
+	for _, o := range obs.list {
+		o.JobCompleted(ev)
+	}
+}
@@ -0,0 +1,80 @@
+package workers
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordObserver counts the events by type.
+type recordObserver struct {
+	mu     sync.Mutex
+	counts map[string]int
+	jobs   map[JobKey]bool
+}
+
+func newRecordObserver() *recordObserver {
+	return &recordObserver{counts: map[string]int{}, jobs: map[JobKey]bool{}}
+}
+
+func (o *recordObserver) task(name string, ev TaskEvent, instance bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.counts[name]++
+	if ev.Time.IsZero() {
+		o.counts["zero time"]++
+	}
+	if instance != (ev.Instance >= 0) {
+		o.counts["bad instance"]++
+	}
+}
+
+func (o *recordObserver) TaskQueued(ev TaskEvent)    { o.task("queued", ev, false) }
+func (o *recordObserver) TaskStarted(ev TaskEvent)   { o.task("started", ev, true) }
+func (o *recordObserver) TaskFinished(ev TaskEvent)  { o.task("finished", ev, true) }
+func (o *recordObserver) TaskCancelled(ev TaskEvent) { o.task("cancelled", ev, true) }
+func (o *recordObserver) JobCompleted(ev JobEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.counts["completed"]++
+	o.jobs[ev.Job] = ev.Response.Success()
+}
+
+func TestObserver(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 1, Work: sleepWork(10*time.Millisecond, false)},
+		{WorkerID: "worker_2", Instances: 2, Work: sleepWork(time.Minute, false)},
+	}
+	requests := []Request{
+		&testRequest{jobid: "job_1", workerid: "worker_1"},
+		&testRequest{jobid: "job_1", workerid: "worker_2"},
+		&testRequest{jobid: "job_2", workerid: "worker_1"},
+	}
+
+	obs := newRecordObserver()
+	executeAll(t, workers, requests, Observe(obs))
+
+	// the request of job_1 to worker_2 is interrupted by the success of worker_1
+	expect := map[string]int{
+		"queued":    3,
+		"started":   3,
+		"finished":  2,
+		"cancelled": 1,
+		"completed": 2,
+	}
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+	for name, n := range expect {
+		if obs.counts[name] != n {
+			t.Errorf("%s events: expected %d, found %d", name, n, obs.counts[name])
+		}
+	}
+	for _, name := range []string{"zero time", "bad instance"} {
+		if obs.counts[name] != 0 {
+			t.Errorf("%d events with %s", obs.counts[name], name)
+		}
+	}
+	if !obs.jobs["job_1"] || !obs.jobs["job_2"] {
+		t.Errorf("expected success of both jobs, found %v", obs.jobs)
+	}
+}
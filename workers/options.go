@@ -0,0 +1,153 @@
+package workers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// Option is an optional setting of the Pool.
+type Option func(*options)
+
+type options struct {
+	jobTimeout time.Duration
+	hedge      *HedgePolicy
+	quorum     int
+	reduce     Reducer
+	observers  observers
+	strategy   Strategy
+	clock      Clock
+	seed       *int64
+
+	maxInFlight int
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{quorum: 1, clock: realClock{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.observers.clock = o.clock
+	if o.jobTimeout < 0 {
+		return nil, fmt.Errorf("Job timeout cannot be negative: %v", o.jobTimeout)
+	}
+	if o.hedge != nil {
+		if err := o.hedge.check(); err != nil {
+			return nil, err
+		}
+	}
+	if o.maxInFlight < 0 {
+		return nil, fmt.Errorf("Max in-flight cannot be negative: %d", o.maxInFlight)
+	}
+	if o.quorum <= 0 {
+		return nil, fmt.Errorf("Quorum must be positive: %d", o.quorum)
+	}
+	return o, nil
+}
+
+// JobTimeout sets the deadline of each job, counted from its submission,
+// so including the time its requests wait in the queues.
+// Zero means no deadline.
+// When the deadline expires, the outstanding requests of the job are cancelled
+// and the job returns the last response received, if any,
+// or a *JobError with ErrJobTimeout.
+func JobTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.jobTimeout = d
+	}
+}
+
+// MaxInFlight limits the number of requests worked at the same time
+// by all the workers, on top of the Instances of each worker.
+// A free slot goes to the waiting worker with fewer requests in flight.
+// A slot is taken by each attempt of a request, after the wait
+// for the rate limit of the worker, and given back before the retry backoff.
+// Zero means no limit.
+func MaxInFlight(n int) Option {
+	return func(o *options) {
+		o.maxInFlight = n
+	}
+}
+
+// Hedge enables the hedging mode with the given policy:
+// the first request of each job is started first, and the next one
+// only if the previous hasn't succeeded within the hedging delay.
+// The requests of a job are started in the order they are passed to Execute.
+func Hedge(policy HedgePolicy) Option {
+	return func(o *options) {
+		o.hedge = &policy
+	}
+}
+
+// Reducer combines the success responses of a job into the job response.
+type Reducer func(job JobKey, responses []Response) Response
+
+// Quorum enables the quorum mode: each job waits for n success responses,
+// then the other requests of the job are cancelled and
+// the reducer combines the success responses into the job response.
+// If the requests of the job are done, or the job deadline expires,
+// before the quorum is reached, the reducer is called with the success
+// responses received so far, if any.
+func Quorum(n int, reduce Reducer) Option {
+	return func(o *options) {
+		o.quorum = n
+		o.reduce = reduce
+	}
+}
+
+// Observe adds an observer of the lifecycle events of the tasks and jobs.
+func Observe(o Observer) Option {
+	return func(opts *options) {
+		opts.observers.list = append(opts.observers.list, o)
+	}
+}
+
+// Ordering sets the strategy ordering the requests in the worker queues.
+// The default strategy is Distribute, or FIFO in hedging mode.
+func Ordering(s Strategy) Option {
+	return func(o *options) {
+		o.strategy = s
+	}
+}
+
+// order returns the requests grouped by worker, in the order of the strategy.
+func (o *options) order(requests []Request) map[WorkerKey][]Request {
+	s := o.strategy
+	if s == nil {
+		if o.hedge != nil {
+			s = FIFO{}
+		} else {
+			s = Distribute{}
+		}
+	}
+	return s.Order(requests)
+}
+
+// WithClock sets the clock of the Pool. The default is the real time clock.
+// All the timers of the Pool, including rate limits, backoffs and timeouts,
+// use this clock.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// Seed sets the seed of the random jitters of the Pool.
+// Each worker has its own source, derived from the seed and the worker key,
+// so its jitters don't depend on the scheduling of the other workers.
+// The default is the global source of math/rand.
+func Seed(seed int64) Option {
+	return func(o *options) {
+		o.seed = &seed
+	}
+}
+
+// randSource returns the source of the random jitters of the worker.
+func (o *options) randSource(wid WorkerKey) *randSource {
+	if o.seed == nil {
+		return nil
+	}
+	h := fnv.New64a()
+	h.Write([]byte(wid))
+	return newRandSource(*o.seed ^ int64(h.Sum64()))
+}
@@ -0,0 +1,394 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPoolClosed is returned by Submit after the Pool is closed.
+var ErrPoolClosed = errors.New("Pool closed")
+
+// Pool is a set of workers accepting new jobs while running.
+type Pool struct {
+	workerMap map[WorkerKey]*workerContextItem
+	queues    map[WorkerKey]*taskQueue
+	opts      *options
+	inflight  *inflightLimiter
+
+	// events to the collector goroutine, until quit is closed
+	events chan jobEvent
+	quit   chan struct{}
+
+	mu        sync.Mutex
+	closed    bool
+	jobs      sync.WaitGroup // jobs in progress
+	instances sync.WaitGroup // running worker instances
+}
+
+// jobEvent is a message to the collector:
+// the response of a request of the job, or nil if the job context is done.
+type jobEvent struct {
+	job *jobContextItem
+	res Response
+}
+
+// size of the buffer of the collector events
+const eventsBuffer = 256
+
+// Future is the pending response of a job submitted to a Pool.
+type Future struct {
+	job  JobKey
+	done chan struct{}
+	res  *JobResult
+}
+
+// Job returns the key of the job.
+func (f *Future) Job() JobKey { return f.job }
+
+// Done returns a channel closed when the job response is available.
+func (f *Future) Done() <-chan struct{} { return f.done }
+
+// Response waits for the job to complete and returns its response.
+func (f *Future) Response() Response {
+	<-f.done
+	return f.res.Response
+}
+
+// Result waits for the job to complete and returns its result,
+// with all the attempts of the job.
+func (f *Future) Result() *JobResult {
+	<-f.done
+	return f.res
+}
+
+func (f *Future) set(res *JobResult) {
+	f.res = res
+	close(f.done)
+}
+
+// NewPool checks the workers and starts their instances.
+// The Pool must be closed to stop the instances.
+func NewPool(workers []*Worker, opts ...Option) (*Pool, error) {
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// check workers and map form workerid to Worker
+	inflight := newInflightLimiter(o.maxInFlight)
+	wm := map[WorkerKey]*workerContextItem{}
+	for _, w := range workers {
+		if _, ok := wm[w.WorkerID]; ok {
+			return nil, fmt.Errorf("Duplicate worker: %q", w.WorkerID)
+		}
+		if w.Instances <= 0 || w.Instances > maxInstances {
+			return nil, fmt.Errorf("Instances must be in 1..%d range: worker=%q", maxInstances, w.WorkerID)
+		}
+		if w.Work == nil {
+			return nil, fmt.Errorf("Work function cannot be nil: worker=%q", w.WorkerID)
+		}
+		if err := w.RateLimit.check(); err != nil {
+			return nil, fmt.Errorf("%s: worker=%q", err, w.WorkerID)
+		}
+		if err := w.Retry.check(); err != nil {
+			return nil, fmt.Errorf("%s: worker=%q", err, w.WorkerID)
+		}
+		if w.Timeout < 0 {
+			return nil, fmt.Errorf("Timeout cannot be negative: worker=%q", w.WorkerID)
+		}
+		if err := w.CircuitBreaker.check(); err != nil {
+			return nil, fmt.Errorf("%s: worker=%q", err, w.WorkerID)
+		}
+		if err := w.Scaling.check(w.Instances); err != nil {
+			return nil, fmt.Errorf("%s: worker=%q", err, w.WorkerID)
+		}
+		rnd := o.randSource(w.WorkerID)
+		wm[w.WorkerID] = &workerContextItem{
+			Worker:   w,
+			limiter:  newRateLimiter(w.RateLimit, rnd),
+			breaker:  newCircuitBreaker(w.CircuitBreaker),
+			scaler:   newScaler(w.Scaling, w.Instances),
+			inflight: inflight,
+			clock:    o.clock,
+			rand:     rnd,
+		}
+	}
+
+	p := &Pool{
+		workerMap: wm,
+		queues:    map[WorkerKey]*taskQueue{},
+		opts:      o,
+		inflight:  inflight,
+		events:    make(chan jobEvent, eventsBuffer),
+		quit:      make(chan struct{}),
+	}
+
+	// Starts the goroutine that collects the responses of all the jobs.
+	go p.collect()
+
+	// Starts the goroutines that executes the real work.
+	// For each worker it starts N goroutines, with N = Instances.
+	// Each goroutine get the input request from the worker task queue,
+	// and put the output response to the job response channel.
+	// With a scaling policy, only the active instances get a request.
+	for wid, worker := range wm {
+		queue := newTaskQueue()
+		p.queues[wid] = queue
+		p.instances.Add(worker.Instances)
+		for i := 0; i < worker.Instances; i++ {
+			go func(w *workerContextItem, instance int, queue *taskQueue) {
+				defer p.instances.Done()
+				for w.scaler.acquire() {
+					t, ok := queue.pop()
+					if !ok {
+						return
+					}
+					p.execute(w, instance, t)
+					w.scaler.release()
+				}
+			}(worker, i, queue)
+		}
+	}
+
+	return p, nil
+}
+
+// Submit submits the requests to the pool.
+// The requests with the same JobID are grouped in a job, whose context
+// is derived from ctx. Jobs of different Submit calls are distinct,
+// even with the same JobID.
+// It returns the futures of the jobs, in order of first request.
+func (p *Pool) Submit(ctx context.Context, requests ...Request) ([]*Future, error) {
+	return p.submit(ctx, requests, nil)
+}
+
+// submit submits the requests to the pool.
+// If not nil, notify is called with the response of each job.
+func (p *Pool) submit(ctx context.Context, requests []Request, notify func(*JobResult)) ([]*Future, error) {
+
+	// check requests and group them by job
+	jobContext := map[JobKey]*jobContextItem{}
+	var jobs []*jobContextItem
+	for _, r := range requests {
+		wid, jid := r.WorkerID(), r.JobID()
+		if _, ok := p.workerMap[wid]; !ok {
+			return nil, fmt.Errorf("Worker not found: worker=%q, job=%q", wid, jid)
+		}
+		jc := jobContext[jid]
+		if jc == nil {
+			jc = &jobContextItem{
+				id:      jid,
+				timeout: p.opts.jobTimeout,
+				clock:   p.opts.clock,
+				future:  &Future{job: jid, done: make(chan struct{})},
+				notify:  notify,
+			}
+			jobContext[jid] = jc
+			jobs = append(jobs, jc)
+		}
+		// NOTE: doesn't check if the worker has already been used for the same job
+		jc.requests = append(jc.requests, r)
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	p.jobs.Add(len(jobs))
+	p.mu.Unlock()
+
+	// Creates the job contexts: the collector is notified
+	// when a job context is done before the job completes.
+	// The job deadline is counted from now, while the requests are queued.
+	futures := make([]*Future, 0, len(jobs))
+	for _, jc := range jobs {
+		jc := jc // captured by the callbacks
+		jc.remaining = len(jc.requests)
+		// the cancellation of ctx is reported with the ErrRunCancelled cause
+		jc.ctx, jc.cancel = context.WithCancelCause(context.WithoutCancel(ctx))
+		jc.unlink = context.AfterFunc(ctx, func() { p.abort(jc, ErrRunCancelled) })
+		jc.start(func() { p.abort(jc, ErrJobTimeout) })
+		futures = append(futures, jc.future)
+	}
+
+	p.enqueue(jobContext, requests)
+	return futures, nil
+}
+
+// Close stops accepting new jobs, waits for the submitted jobs to complete
+// and stops the worker instances.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.jobs.Wait()
+	for _, q := range p.queues {
+		q.close()
+	}
+	for _, w := range p.workerMap {
+		w.scaler.close()
+	}
+	p.instances.Wait()
+	close(p.quit)
+}
+
+// enqueue appends the tasks of the submitted requests to the worker queues,
+// in the order given by the strategy.
+// In hedging mode, only the first request of each job is enqueued:
+// the others are kept pending in the job.
+func (p *Pool) enqueue(jobContext map[JobKey]*jobContextItem, requests []Request) {
+	if p.opts.hedge != nil {
+		first := make([]Request, 0, len(jobContext))
+		for _, r := range requests {
+			jc := jobContext[r.JobID()]
+			if jc.pending == nil {
+				first = append(first, r)
+				jc.pending = jc.requests[1:]
+			}
+		}
+		requests = first
+	}
+	wr := p.opts.order(requests)
+
+	for wid, reqs := range wr {
+		tasks := make([]*task, 0, len(reqs))
+		for _, r := range reqs {
+			jc := jobContext[r.JobID()]
+			jc.mu.Lock()
+			tasks = append(tasks, jc.newTask(r))
+			jc.mu.Unlock()
+			p.opts.observers.taskQueued(r)
+		}
+		p.queues[wid].push(tasks...)
+	}
+}
+
+// execute works the task and sends the response to the job.
+// Tasks of jobs already done are skipped.
+func (p *Pool) execute(w *workerContextItem, instance int, t *task) {
+	obs := p.opts.observers
+	if t.job.ctx.Err() != nil {
+		obs.taskCancelled(t.req, instance, nil, t.job.err())
+		return
+	}
+	obs.taskStarted(t.req, instance)
+	t.job.started(t)
+
+	var hedged func(Response)
+	if p.opts.hedge != nil {
+		hedged = p.hedge(w, t)
+	}
+
+	start := w.clock.Now()
+	res := w.work(t)
+	if res.Success() {
+		w.latencies.add(since(w.clock, start))
+	}
+
+	if hedged != nil {
+		hedged(res)
+	}
+	t.job.finished(t, res)
+	if t.job.done.Load() || t.job.ctx.Err() != nil {
+		obs.taskCancelled(t.req, instance, res, t.job.err())
+	} else {
+		obs.taskFinished(t.req, instance, res)
+	}
+	p.post(jobEvent{job: t.job, res: res})
+}
+
+// post sends the event to the collector.
+// Events posted after the Pool is closed are discarded.
+func (p *Pool) post(ev jobEvent) {
+	select {
+	case p.events <- ev:
+	case <-p.quit:
+	}
+}
+
+// abort cancels the job context with the cause, and notifies the collector.
+func (p *Pool) abort(jc *jobContextItem, cause error) {
+	jc.cancel(cause)
+	p.post(jobEvent{job: jc})
+}
+
+// collect receives the events of all the jobs, until the Pool is closed.
+func (p *Pool) collect() {
+	for {
+		select {
+		case ev := <-p.events:
+			p.receive(ev)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// receive updates the job with the event, and completes the job
+// at the first success response, or once all the responses are received.
+// In quorum mode, it waits for the quorum of success responses.
+// If the job context is done before, the job is completed at once.
+func (p *Pool) receive(ev jobEvent) {
+	jc := ev.job
+	if jc.completed {
+		// event of a job already completed
+		return
+	}
+	if res := ev.res; res != nil {
+		jc.remaining--
+		jc.last = res
+		if res.Success() {
+			jc.successes = append(jc.successes, res)
+		}
+		if len(jc.successes) < p.opts.quorum && jc.remaining > 0 {
+			return
+		}
+	}
+	p.complete(jc)
+}
+
+// complete cancels the outstanding requests of the job,
+// and notifies the job result.
+func (p *Pool) complete(jc *jobContextItem) {
+	jc.completed = true
+
+	cause := context.Canceled
+	if len(jc.successes) > 0 {
+		cause = ErrSiblingSucceeded
+	}
+	jc.unlink()
+	jc.cancel(cause)
+	jc.done.Store(true)
+	jc.stop()
+
+	res := p.jobResponse(jc)
+	p.opts.observers.jobCompleted(jc.id, res)
+	result := jc.result(res)
+	jc.future.set(result)
+	if jc.notify != nil {
+		jc.notify(result)
+	}
+	p.jobs.Done()
+}
+
+// jobResponse returns the first success response of the job,
+// or the last response if none succeeded.
+// If no response was received, it returns a *JobError.
+// In quorum mode, it returns the response of the reducer.
+func (p *Pool) jobResponse(jc *jobContextItem) Response {
+	switch {
+	case len(jc.successes) > 0 && p.opts.reduce != nil:
+		return p.opts.reduce(jc.id, jc.successes)
+	case len(jc.successes) > 0:
+		return jc.successes[0]
+	case jc.last != nil:
+		return jc.last
+	default:
+		return &JobError{Job: jc.id, Err: jc.err()}
+	}
+}
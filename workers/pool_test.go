@@ -0,0 +1,77 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoolSubmit(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 1, Work: sleepWork(20*time.Millisecond, false)},
+		{WorkerID: "worker_2", Instances: 1, Work: sleepWork(10*time.Millisecond, true)},
+	}
+	p, err := NewPool(workers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// first batch
+	f1, err := p.Submit(ctx,
+		&testRequest{jobid: "job_1", workerid: "worker_1"},
+		&testRequest{jobid: "job_1", workerid: "worker_2"},
+		&testRequest{jobid: "job_2", workerid: "worker_2"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f1) != 2 || f1[0].Job() != "job_1" || f1[1].Job() != "job_2" {
+		t.Fatalf("unexpected futures %v", f1)
+	}
+	if res := f1[0].Response(); !res.Success() {
+		t.Error("job_1: expected success")
+	}
+
+	// second batch, submitted while running, with a job key already used
+	f2, err := p.Submit(ctx, &testRequest{jobid: "job_1", workerid: "worker_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Close waits for the pending jobs
+	p.Close()
+	for _, f := range append(f1, f2...) {
+		select {
+		case <-f.Done():
+		default:
+			t.Errorf("%s: not done after Close", f.Job())
+		}
+	}
+	if res := f1[1].Response(); res.Success() {
+		t.Error("job_2: expected failure")
+	}
+	if res := f2[0].Response(); !res.Success() {
+		t.Error("job_1 (second batch): expected success")
+	}
+
+	if _, err := p.Submit(ctx, &testRequest{jobid: "job_3", workerid: "worker_1"}); err != ErrPoolClosed {
+		t.Errorf("Submit after Close: expected %v, found %v", ErrPoolClosed, err)
+	}
+}
+
+func TestPoolSubmitUnknownWorker(t *testing.T) {
+	p, err := NewPool([]*Worker{{WorkerID: "worker_1", Instances: 1, Work: fnWork}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	_, err = p.Submit(context.Background(),
+		&testRequest{jobid: "job_1", workerid: "worker_1"},
+		&testRequest{jobid: "job_1", workerid: "worker_9"},
+	)
+	if err == nil {
+		t.Error("expected error, found nil")
+	}
+}
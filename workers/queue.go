@@ -0,0 +1,61 @@
+package workers
+
+import "sync"
+
+// taskQueue is the queue of the tasks of a worker,
+// shared by all the instances of the worker.
+type taskQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	tasks  []*task
+	closed bool
+}
+
+func newTaskQueue() *taskQueue {
+	q := &taskQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push appends the tasks to the end of the queue.
+func (q *taskQueue) push(tasks ...*task) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, tasks...)
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// pushFront inserts the task at the start of the queue.
+func (q *taskQueue) pushFront(t *task) {
+	q.mu.Lock()
+	q.tasks = append([]*task{t}, q.tasks...)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop removes and returns the first task of the queue.
+// It blocks while the queue is empty and not closed.
+// It returns false if the queue is empty and closed.
+func (q *taskQueue) pop() (*task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.tasks) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.tasks) == 0 {
+		return nil, false
+	}
+	t := q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	return t, true
+}
+
+// close wakes up the instances waiting on the queue.
+// The tasks already in the queue can still be popped.
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
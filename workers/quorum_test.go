@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// joinReducer returns a success response
+// with the sorted list of the workers of the responses.
+func joinReducer(job JobKey, responses []Response) Response {
+	a := make([]string, 0, len(responses))
+	for _, r := range responses {
+		a = append(a, r.(*testResponse).workerid)
+	}
+	sort.Strings(a)
+	return &testResponse{jobid: string(job), result: strings.Join(a, ",")}
+}
+
+func TestQuorum(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	testCases := []struct {
+		name   string
+		quorum int
+		fail3  bool
+		expect string
+		calls4 int32
+	}{
+		{"quorum reached", 2, false, "worker_1,worker_2", 0},
+		{"quorum reached with a failure", 3, true, "worker_1,worker_2,worker_4", 1},
+	}
+
+	for _, tc := range testCases {
+		var calls4 int32
+		workers := []*Worker{
+			{WorkerID: "worker_1", Instances: 1, Work: sleepWork(ms(10), false)},
+			{WorkerID: "worker_2", Instances: 1, Work: sleepWork(ms(20), false)},
+			{WorkerID: "worker_3", Instances: 1, Work: sleepWork(ms(30), tc.fail3)},
+			// worker_4 starts after the hedging delay, or after the failure of worker_3
+			{WorkerID: "worker_4", Instances: 1, Work: countedWork(sleepWork(ms(10), false), &calls4)},
+		}
+		requests := []Request{
+			&testRequest{jobid: "job_1", workerid: "worker_1"},
+			&testRequest{jobid: "job_1", workerid: "worker_2"},
+			&testRequest{jobid: "job_1", workerid: "worker_3"},
+			&testRequest{jobid: "job_1", workerid: "worker_4"},
+		}
+
+		res := executeAll(t, workers, requests,
+			Quorum(tc.quorum, joinReducer),
+			Hedge(HedgePolicy{Delay: time.Hour}))
+
+		if len(res) != 1 {
+			t.Fatalf("[%s] expected 1 response, found %d", tc.name, len(res))
+		}
+		tres := res[0].(*testResponse)
+		if tres.result != tc.expect {
+			t.Errorf("[%s] expected %q, found %q", tc.name, tc.expect, tres.result)
+		}
+		if n := atomic.LoadInt32(&calls4); n != tc.calls4 {
+			t.Errorf("[%s] worker_4 calls: expected %d, found %d", tc.name, tc.calls4, n)
+		}
+	}
+}
+
+func TestQuorumNotReached(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 1, Work: sleepWork(10*time.Millisecond, false)},
+		{WorkerID: "worker_2", Instances: 1, Work: sleepWork(10*time.Millisecond, true)},
+	}
+	requests := []Request{
+		&testRequest{jobid: "job_1", workerid: "worker_1"},
+		&testRequest{jobid: "job_1", workerid: "worker_2"},
+		&testRequest{jobid: "job_2", workerid: "worker_2"},
+	}
+
+	res := executeAll(t, workers, requests, Quorum(2, joinReducer))
+	if len(res) != 2 {
+		t.Fatalf("expected 2 responses, found %d", len(res))
+	}
+	for _, r := range res {
+		tres := r.(*testResponse)
+		switch tres.jobid {
+		case "job_1":
+			// reduced with the only success response
+			if tres.result != "worker_1" {
+				t.Errorf("job_1: expected %q, found %q", "worker_1", tres.result)
+			}
+		case "job_2":
+			// no success response: the reducer is not called
+			if tres.Success() {
+				t.Error("job_2: expected failure")
+			}
+		}
+	}
+}
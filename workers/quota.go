@@ -0,0 +1,7 @@
+package workers
+
+import "errors"
+
+// ErrQuotaExhausted is the error of the requests not worked
+// because the quota of the worker is exhausted.
+var ErrQuotaExhausted = errors.New("Quota exhausted")
@@ -0,0 +1,47 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestQuotaExhausted(t *testing.T) {
+	var calls int32
+	work := func(ctx context.Context, req Request) Response {
+		atomic.AddInt32(&calls, 1)
+		return &testResponse{jobid: string(req.JobID()), workerid: string(req.WorkerID()), err: ErrQuotaExhausted}
+	}
+	exhausted := func(res Response) bool {
+		r, ok := res.(*testResponse)
+		return ok && errors.Is(r.err, ErrQuotaExhausted)
+	}
+	workers := []*Worker{{
+		WorkerID:       "worker_1",
+		Instances:      1,
+		Work:           work,
+		CircuitBreaker: CircuitBreaker{ConsecutiveFailures: 1},
+		Exhausted:      exhausted,
+	}}
+	var requests []Request
+	for j := 1; j <= 3; j++ {
+		requests = append(requests, &testRequest{jobid: fmt.Sprintf("job_%d", j), workerid: "worker_1"})
+	}
+
+	// the requests after the exhaustion fail at once,
+	// without opening the circuit
+	var notWorked int
+	for _, res := range executeAll(t, workers, requests) {
+		if te, ok := res.(*TaskError); ok {
+			if !errors.Is(te, ErrQuotaExhausted) {
+				t.Errorf("expected %v, found %v", ErrQuotaExhausted, te)
+			}
+			notWorked++
+		}
+	}
+	if calls != 1 || notWorked != 2 {
+		t.Errorf("expected 1 call and 2 requests not worked, found %d and %d", calls, notWorked)
+	}
+}
@@ -0,0 +1,138 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimit is the rate policy of a worker.
+// It is enforced across all the instances of the worker.
+// The zero value means no limit.
+type RateLimit struct {
+	// Requests is the max number of requests started in each Interval.
+	Requests int
+	// Interval is the time window of the Requests limit.
+	Interval time.Duration
+	// MinDelay is the minimum delay between the start of two requests.
+	MinDelay time.Duration
+	// Jitter is the max random delay added to the start of each request.
+	Jitter time.Duration
+}
+
+func (rl *RateLimit) check() error {
+	if rl.Requests < 0 {
+		return fmt.Errorf("RateLimit.Requests cannot be negative: %d", rl.Requests)
+	}
+	if rl.Requests > 0 && rl.Interval <= 0 {
+		return fmt.Errorf("RateLimit.Interval must be positive: %v", rl.Interval)
+	}
+	if rl.MinDelay < 0 {
+		return fmt.Errorf("RateLimit.MinDelay cannot be negative: %v", rl.MinDelay)
+	}
+	if rl.Jitter < 0 {
+		return fmt.Errorf("RateLimit.Jitter cannot be negative: %v", rl.Jitter)
+	}
+	return nil
+}
+
+// rateLimiter assigns the start time to the requests of a worker.
+type rateLimiter struct {
+	mu     sync.Mutex
+	policy RateLimit
+	starts []reservation // reservations of the recent requests, in order
+	seq    int           // number of the last reservation
+	rand   *randSource   // source of the jitter
+}
+
+// reservation is the start time assigned to a request.
+type reservation struct {
+	start time.Time
+	seq   int
+}
+
+func newRateLimiter(policy RateLimit, rnd *randSource) *rateLimiter {
+	return &rateLimiter{policy: policy, rand: rnd}
+}
+
+// reserve returns the reservation of the start time of the next request.
+func (l *rateLimiter) reserve(now time.Time) reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p := &l.policy
+	l.prune(now)
+	t := now
+	if n := len(l.starts); n > 0 {
+		// start times are assigned in reservation order
+		last := l.starts[n-1].start
+		if t.Before(last) {
+			t = last
+		}
+		if p.MinDelay > 0 {
+			if earliest := last.Add(p.MinDelay); t.Before(earliest) {
+				t = earliest
+			}
+		}
+		if p.Requests > 0 && n >= p.Requests {
+			if earliest := l.starts[n-p.Requests].start.Add(p.Interval); t.Before(earliest) {
+				t = earliest
+			}
+		}
+	}
+	if p.Jitter > 0 {
+		t = t.Add(time.Duration(l.rand.int63n(int64(p.Jitter))))
+	}
+
+	l.seq++
+	r := reservation{start: t, seq: l.seq}
+	l.starts = append(l.starts, r)
+	return r
+}
+
+// prune forgets the reservations that can't delay the requests
+// starting from now on.
+func (l *rateLimiter) prune(now time.Time) {
+	horizon := l.policy.MinDelay
+	if l.policy.Requests > 0 && l.policy.Interval > horizon {
+		horizon = l.policy.Interval
+	}
+	j := 0
+	for j < len(l.starts) && !l.starts[j].start.Add(horizon).After(now) {
+		j++
+	}
+	l.starts = l.starts[j:]
+}
+
+// cancel gives back the reservation of a request that didn't start.
+// The requests reserved later keep their start time: the slot goes
+// to the next reservations, if it's the last one or it fills a place
+// in the window of the Requests limit.
+func (l *rateLimiter) cancel(r reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for j, x := range l.starts {
+		if x.seq == r.seq {
+			l.starts = append(l.starts[:j], l.starts[j+1:]...)
+			return
+		}
+	}
+}
+
+// wait blocks until the next request can start.
+// It returns the context error if the context is done before,
+// giving back the reservation to the next requests.
+func (l *rateLimiter) wait(ctx context.Context, c Clock) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := c.Now()
+	r := l.reserve(now)
+	if err := sleep(ctx, c, r.start.Sub(now)); err != nil {
+		l.cancel(r)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	testCases := []struct {
+		name   string
+		policy RateLimit
+		now    []int // msec from t0 of each reserve call
+		expect []int // msec from t0 of each reserved start
+	}{
+		{"no limit", RateLimit{}, []int{0, 0, 0}, []int{0, 0, 0}},
+		{"min delay", RateLimit{MinDelay: ms(100)}, []int{0, 0, 50, 500}, []int{0, 100, 200, 500}},
+		{"requests per interval", RateLimit{Requests: 2, Interval: ms(1000)}, []int{0, 10, 20, 30, 1500}, []int{0, 10, 1000, 1010, 2000}},
+		{"both", RateLimit{Requests: 2, Interval: ms(1000), MinDelay: ms(300)}, []int{0, 0, 0}, []int{0, 300, 1000}},
+	}
+
+	for _, tc := range testCases {
+		l := newRateLimiter(tc.policy, nil)
+		for j, now := range tc.now {
+			got := l.reserve(t0.Add(ms(now))).start.Sub(t0)
+			if got != ms(tc.expect[j]) {
+				t.Errorf("[%s] reserve #%d: expected %v, found %v", tc.name, j+1, ms(tc.expect[j]), got)
+			}
+		}
+	}
+}
+
+func TestRateLimiterJitter(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	l := newRateLimiter(RateLimit{MinDelay: time.Second, Jitter: 500 * time.Millisecond}, nil)
+
+	prev := t0
+	for j := 0; j < 10; j++ {
+		got := l.reserve(t0).start
+		if j > 0 {
+			d := got.Sub(prev)
+			if d < time.Second || d >= 1500*time.Millisecond {
+				t.Errorf("reserve #%d: delay %v out of range", j+1, d)
+			}
+		}
+		prev = got
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	testCases := []struct {
+		name   string
+		policy RateLimit
+		before int // reservations before the cancelled one
+		expect int // msec from t0 of the reservation after the cancelled one
+	}{
+		{"min delay", RateLimit{MinDelay: ms(100)}, 1, 100},
+		{"requests per interval", RateLimit{Requests: 1, Interval: ms(1000)}, 1, 1000},
+		{"window not full", RateLimit{Requests: 2, Interval: ms(1000)}, 1, 0},
+		{"window full", RateLimit{Requests: 2, Interval: ms(1000)}, 2, 1000},
+	}
+	for _, tc := range testCases {
+		l := newRateLimiter(tc.policy, nil)
+		for j := 0; j < tc.before; j++ {
+			l.reserve(t0)
+		}
+		// the slot of the cancelled request is given back
+		l.cancel(l.reserve(t0))
+		if got := l.reserve(t0).start.Sub(t0); got != ms(tc.expect) {
+			t.Errorf("[%s] expected %v, found %v", tc.name, ms(tc.expect), got)
+		}
+	}
+
+	// a reservation followed by others is given back too
+	l := newRateLimiter(RateLimit{Requests: 2, Interval: ms(1000)}, nil)
+	r := l.reserve(t0)
+	l.reserve(t0)
+	l.cancel(r)
+	if got := l.reserve(t0).start.Sub(t0); got != 0 {
+		t.Errorf("expected 0s, found %v", got)
+	}
+}
+
+func TestRateLimiterWaitCancel(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	clock := &manualClock{now: t0}
+	l := newRateLimiter(RateLimit{MinDelay: 100 * time.Millisecond}, nil)
+	l.reserve(t0)
+
+	// two waits, for the slots at 100ms and 200ms
+	var cancels []context.CancelFunc
+	errs := make(chan error, 2)
+	for j := 1; j <= 2; j++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancels = append(cancels, cancel)
+		go func() { errs <- l.wait(ctx, clock) }()
+		for waiting := false; !waiting; {
+			time.Sleep(time.Millisecond)
+			clock.mu.Lock()
+			waiting = len(clock.timers) == j
+			clock.mu.Unlock()
+		}
+	}
+
+	// cancelled out of order: both the slots are given back
+	for _, cancel := range cancels {
+		cancel()
+		if err := <-errs; err != context.Canceled {
+			t.Errorf("expected %v, found %v", context.Canceled, err)
+		}
+	}
+	if got := l.reserve(t0).start.Sub(t0); got != 100*time.Millisecond {
+		t.Errorf("expected 100ms, found %v", got)
+	}
+}
+
+func TestRateLimitCheck(t *testing.T) {
+	invalid := []RateLimit{
+		{Requests: -1},
+		{Requests: 1},
+		{MinDelay: -time.Second},
+		{Jitter: -time.Second},
+	}
+	for _, rl := range invalid {
+		if err := rl.check(); err == nil {
+			t.Errorf("%+v: expected error, found nil", rl)
+		}
+	}
+	if err := (&RateLimit{Requests: 5, Interval: time.Minute}).check(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,160 @@
+package workers
+
+import (
+	"sync"
+	"time"
+)
+
+// Outcome is the outcome of an attempt of a job.
+type Outcome int
+
+// Outcomes of an attempt.
+const (
+	// NeverStarted is the outcome of a request not started before the job completed.
+	NeverStarted Outcome = iota
+	// Succeeded is the outcome of a request with a success response.
+	Succeeded
+	// Failed is the outcome of a request with a failed response.
+	Failed
+	// Cancelled is the outcome of a request interrupted because the job
+	// completed, or its context was done.
+	Cancelled
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case NeverStarted:
+		return "never started"
+	case Succeeded:
+		return "success"
+	case Failed:
+		return "error"
+	case Cancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Attempt is a request of a job, with its outcome.
+type Attempt struct {
+	Request Request
+	Outcome Outcome
+	// Response of the request. It is nil if the request was never started,
+	// or was still running when the job completed.
+	Response Response
+	// TimeStart and TimeEnd of the request, if started and ended.
+	TimeStart time.Time
+	TimeEnd   time.Time
+	// Cause of the cancellation, if cancelled.
+	Cause error
+}
+
+// JobResult is the result of a job: the job response
+// and every request of the job, with its outcome.
+type JobResult struct {
+	Job JobKey
+	// Response of the job, as returned by Execute.
+	Response Response
+	// Attempts of the job, in the order they were queued.
+	// The requests never queued, in hedging mode, come last.
+	Attempts []Attempt
+}
+
+// newTask returns the task of the request, tracking its attempt.
+// The caller must hold jc.mu.
+func (jc *jobContextItem) newTask(req Request) *task {
+	a := &Attempt{Request: req}
+	jc.attempts = append(jc.attempts, a)
+	return &task{job: jc, req: req, attempt: a}
+}
+
+// started records the start of the task.
+func (jc *jobContextItem) started(t *task) {
+	jc.mu.Lock()
+	t.attempt.TimeStart = jc.clock.Now()
+	jc.mu.Unlock()
+}
+
+// finished records the response of the task.
+func (jc *jobContextItem) finished(t *task, res Response) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	a := t.attempt
+	a.TimeEnd = jc.clock.Now()
+	a.Response = res
+	switch {
+	case jc.done.Load() || jc.ctx.Err() != nil:
+		a.Outcome = Cancelled
+		a.Cause = jc.err()
+	case res.Success():
+		a.Outcome = Succeeded
+	default:
+		a.Outcome = Failed
+	}
+}
+
+// result returns the result of the job with a snapshot of its attempts.
+// Attempts started but not finished are cancelled.
+func (jc *jobContextItem) result(res Response) *JobResult {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+
+	attempts := make([]Attempt, 0, len(jc.requests))
+	for _, a := range jc.attempts {
+		item := *a
+		if !item.TimeStart.IsZero() && item.TimeEnd.IsZero() {
+			item.Outcome = Cancelled
+			item.Cause = jc.err()
+		}
+		attempts = append(attempts, item)
+	}
+	for _, req := range jc.pending {
+		attempts = append(attempts, Attempt{Request: req})
+	}
+	return &JobResult{Job: jc.id, Response: res, Attempts: attempts}
+}
+
+// resultQueue is an unbounded FIFO queue of job results.
+type resultQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	results []*JobResult
+	closed  bool
+}
+
+func newResultQueue() *resultQueue {
+	q := &resultQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *resultQueue) push(res *JobResult) {
+	q.mu.Lock()
+	q.results = append(q.results, res)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop waits for the next result.
+// It returns false if the queue is closed and empty.
+func (q *resultQueue) pop() (*JobResult, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.results) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.results) == 0 {
+		return nil, false
+	}
+	res := q.results[0]
+	q.results[0] = nil
+	q.results = q.results[1:]
+	return res, true
+}
+
+func (q *resultQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Signal()
+}
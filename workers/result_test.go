@@ -0,0 +1,71 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func outcomes(res *JobResult) map[WorkerKey]Outcome {
+	m := map[WorkerKey]Outcome{}
+	for _, a := range res.Attempts {
+		m[a.Request.WorkerID()] = a.Outcome
+	}
+	return m
+}
+
+func TestJobResult(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 1, Work: sleepWork(10*time.Millisecond, true)},
+		{WorkerID: "worker_2", Instances: 1, Work: sleepWork(30*time.Millisecond, false)},
+		{WorkerID: "worker_3", Instances: 1, Work: sleepWork(time.Minute, false)},
+	}
+	requests := []Request{
+		&testRequest{jobid: "job_1", workerid: "worker_1"},
+		&testRequest{jobid: "job_1", workerid: "worker_2"},
+		&testRequest{jobid: "job_1", workerid: "worker_3"},
+	}
+
+	testCases := map[string]struct {
+		opts     []Option
+		expected map[WorkerKey]Outcome
+	}{
+		"parallel": {nil, map[WorkerKey]Outcome{
+			"worker_1": Failed,
+			"worker_2": Succeeded,
+			"worker_3": Cancelled,
+		}},
+		// the failure of worker_1 starts worker_2 at once
+		"hedge": {[]Option{Hedge(HedgePolicy{Delay: time.Hour})}, map[WorkerKey]Outcome{
+			"worker_1": Failed,
+			"worker_2": Succeeded,
+			"worker_3": NeverStarted,
+		}},
+	}
+
+	for name, tc := range testCases {
+		out, err := ExecuteVerbose(context.Background(), workers, requests, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var results []*JobResult
+		for res := range out {
+			results = append(results, res)
+		}
+		if len(results) != 1 {
+			t.Fatalf("%s: expected 1 result, found %d", name, len(results))
+		}
+		res := results[0]
+		if !res.Response.Success() {
+			t.Errorf("%s: expected success, found %v", name, res.Response)
+		}
+		if len(res.Attempts) != len(requests) {
+			t.Errorf("%s: expected %d attempts, found %d", name, len(requests), len(res.Attempts))
+		}
+		for wid, o := range outcomes(res) {
+			if o != tc.expected[wid] {
+				t.Errorf("%s: %s expected %q, found %q", name, wid, tc.expected[wid], o)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetryPolicy is the retry policy of a worker.
+// The zero value means no retry.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts of each request,
+	// including the first one.
+	MaxAttempts int
+	// Backoff is the delay before the first retry.
+	// The delay doubles at each following retry.
+	Backoff time.Duration
+	// MaxBackoff is the upper bound of the delay. Zero means no bound.
+	MaxBackoff time.Duration
+	// Jitter is the max random delay added to each backoff.
+	Jitter time.Duration
+	// Retryable reports whether a failed response can be retried.
+	// If nil, every failed response is retried.
+	Retryable func(Response) bool
+}
+
+func (rp *RetryPolicy) check() error {
+	if rp.MaxAttempts < 0 {
+		return fmt.Errorf("RetryPolicy.MaxAttempts cannot be negative: %d", rp.MaxAttempts)
+	}
+	if rp.Backoff < 0 {
+		return fmt.Errorf("RetryPolicy.Backoff cannot be negative: %v", rp.Backoff)
+	}
+	if rp.MaxBackoff < 0 {
+		return fmt.Errorf("RetryPolicy.MaxBackoff cannot be negative: %v", rp.MaxBackoff)
+	}
+	if rp.Jitter < 0 {
+		return fmt.Errorf("RetryPolicy.Jitter cannot be negative: %v", rp.Jitter)
+	}
+	return nil
+}
+
+// retry reports whether the failed response of the given attempt
+// must be retried.
+func (rp *RetryPolicy) retry(attempt int, res Response) bool {
+	if attempt >= rp.MaxAttempts {
+		return false
+	}
+	return rp.Retryable == nil || rp.Retryable(res)
+}
+
+// backoff returns the delay before the retry of the given attempt.
+func (rp *RetryPolicy) backoff(attempt int, rnd *randSource) time.Duration {
+	d := rp.Backoff
+	for j := 1; j < attempt && (rp.MaxBackoff == 0 || d < rp.MaxBackoff); j++ {
+		d *= 2
+	}
+	if rp.MaxBackoff > 0 && d > rp.MaxBackoff {
+		d = rp.MaxBackoff
+	}
+	if rp.Jitter > 0 {
+		d += time.Duration(rnd.int63n(int64(rp.Jitter)))
+	}
+	return d
+}
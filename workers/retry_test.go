@@ -0,0 +1,72 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingWork returns a work function that fails the first n calls
+// and counts the calls in *calls.
+func countingWork(n int32, calls *int32) WorkFunc {
+	return func(ctx context.Context, req Request) Response {
+		res := &testResponse{
+			jobid:    string(req.JobID()),
+			workerid: string(req.WorkerID()),
+		}
+		if atomic.AddInt32(calls, 1) <= n {
+			res.err = errors.New("ERR")
+		}
+		return res
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	rp := RetryPolicy{MaxAttempts: 10, Backoff: ms(100), MaxBackoff: ms(500)}
+	expect := []int{100, 200, 400, 500, 500}
+	for j, e := range expect {
+		if got := rp.backoff(j+1, nil); got != ms(e) {
+			t.Errorf("backoff(%d): expected %v, found %v", j+1, ms(e), got)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		name      string
+		fails     int32
+		retry     RetryPolicy
+		calls     int32
+		succeeded bool
+	}{
+		{"no retry", 2, RetryPolicy{}, 1, false},
+		{"success after retries", 2, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, 3, true},
+		{"max attempts reached", 5, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, 3, false},
+		{"not retryable", 2, RetryPolicy{MaxAttempts: 3, Retryable: func(Response) bool { return false }}, 1, false},
+	}
+
+	for _, tc := range testCases {
+		var calls int32
+		workers := []*Worker{
+			{WorkerID: "worker_1", Instances: 1, Work: countingWork(tc.fails, &calls), Retry: tc.retry},
+		}
+		requests := []Request{&testRequest{jobid: "job_1", workerid: "worker_1"}}
+
+		out, err := Execute(context.Background(), workers, requests)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for res := range out {
+			if res.Success() != tc.succeeded {
+				t.Errorf("[%s] success: expected %v, found %v", tc.name, tc.succeeded, res.Success())
+			}
+		}
+		if calls != tc.calls {
+			t.Errorf("[%s] calls: expected %d, found %d", tc.name, tc.calls, calls)
+		}
+	}
+}
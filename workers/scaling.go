@@ -0,0 +1,131 @@
+package workers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Scaling is the adaptive scaling policy of a worker: the number of its
+// active instances changes between MinInstances and Instances, according
+// to the observed responses (AIMD). It grows by one after a round of success
+// responses, i.e. as many as the active instances, and it is halved
+// at a failed response or at a success response slower than Latency.
+// The zero value means no scaling: all the instances are active.
+type Scaling struct {
+	// MinInstances is the initial and min number of active instances.
+	// Zero means no scaling.
+	MinInstances int
+	// Latency, if positive, is the target latency of the requests.
+	// Zero means only the failed responses halve the active instances.
+	Latency time.Duration
+}
+
+func (s *Scaling) check(instances int) error {
+	if s.MinInstances < 0 || s.MinInstances > instances {
+		return fmt.Errorf("Scaling.MinInstances must be in 0..%d range: %d", instances, s.MinInstances)
+	}
+	if s.Latency < 0 {
+		return fmt.Errorf("Scaling.Latency cannot be negative: %v", s.Latency)
+	}
+	return nil
+}
+
+func (s *Scaling) enabled() bool {
+	return s.MinInstances > 0
+}
+
+// scaler limits the active instances of a worker.
+// The nil scaler has no limit.
+type scaler struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	policy    Scaling
+	max       int
+	limit     int       // active instances allowed
+	active    int       // instances working a task
+	successes int       // since the last change of the limit
+	decreased time.Time // time of the last decrease of the limit
+	closed    bool
+}
+
+func newScaler(policy Scaling, instances int) *scaler {
+	if !policy.enabled() {
+		return nil
+	}
+	s := &scaler{policy: policy, max: instances, limit: policy.MinInstances}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// acquire waits for the instance to become active.
+// It returns false if the scaler is closed.
+func (s *scaler) acquire() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed && s.active >= s.limit {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return false
+	}
+	s.active++
+	return true
+}
+
+// release makes the instance inactive.
+func (s *scaler) release() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+// record updates the limit with the response of a request
+// started and ended at the given times.
+// A slow or failed request started before the last decrease
+// doesn't decrease the limit again.
+func (s *scaler) record(start, end time.Time, success bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slow := s.policy.Latency > 0 && end.Sub(start) > s.policy.Latency
+	if success && !slow {
+		s.successes++
+		if s.successes >= s.limit && s.limit < s.max {
+			s.limit++
+			s.successes = 0
+			s.cond.Broadcast()
+		}
+		return
+	}
+	if start.Before(s.decreased) {
+		return
+	}
+	s.limit /= 2
+	if s.limit < s.policy.MinInstances {
+		s.limit = s.policy.MinInstances
+	}
+	s.successes = 0
+	s.decreased = end
+}
+
+// close wakes up the instances waiting to become active.
+func (s *scaler) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
@@ -0,0 +1,90 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScaler(t *testing.T) {
+	t0 := time.Date(2017, 2, 1, 9, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+
+	s := newScaler(Scaling{MinInstances: 2, Latency: 100 * time.Millisecond}, 5)
+	expect := func(limit int) {
+		t.Helper()
+		if s.limit != limit {
+			t.Errorf("expected limit %d, found %d", limit, s.limit)
+		}
+	}
+
+	// a round of successes adds an instance
+	s.record(ms(0), ms(10), true)
+	expect(2)
+	s.record(ms(0), ms(10), true)
+	expect(3)
+	for j := 0; j < 3; j++ {
+		s.record(ms(10), ms(20), true)
+	}
+	expect(4)
+
+	// a slow success halves the instances, not below the min
+	s.record(ms(20), ms(200), true)
+	expect(2)
+	// a failure of a request started before the decrease is ignored
+	s.record(ms(100), ms(210), false)
+	expect(2)
+
+	// up to the max
+	for j := 0; j < 20; j++ {
+		s.record(ms(300), ms(310), true)
+	}
+	expect(5)
+	s.record(ms(300), ms(320), false)
+	expect(2)
+}
+
+func TestScalingCheck(t *testing.T) {
+	work := sleepWork(0, false)
+	for _, sc := range []Scaling{{MinInstances: 3}, {MinInstances: -1}, {MinInstances: 1, Latency: -1}} {
+		_, err := NewPool([]*Worker{{WorkerID: "worker_1", Instances: 2, Work: work, Scaling: sc}})
+		if err == nil {
+			t.Errorf("expected error for %+v", sc)
+		}
+	}
+}
+
+func TestScaling(t *testing.T) {
+	var mu sync.Mutex
+	var running, peak int
+	work := func(ctx context.Context, req Request) Response {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		res := sleepWork(5*time.Millisecond, true)(ctx, req)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return res
+	}
+
+	// the failures keep the worker at its min instances
+	workers := []*Worker{{WorkerID: "worker_1", Instances: 4, Work: work, Scaling: Scaling{MinInstances: 1}}}
+	var requests []Request
+	for j := 1; j <= 8; j++ {
+		requests = append(requests, &testRequest{jobid: fmt.Sprintf("job_%d", j), workerid: "worker_1"})
+	}
+
+	res := executeAll(t, workers, requests)
+	if len(res) != len(requests) {
+		t.Errorf("expected %d responses, found %d", len(requests), len(res))
+	}
+	if peak != 1 {
+		t.Errorf("expected 1 active instance, found %d", peak)
+	}
+}
@@ -0,0 +1,366 @@
+//go:build go1.25
+
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// simEpoch is the start time of the simulations.
+var simEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// simClock is a virtual Clock. The time doesn't flow by itself:
+// run moves it to the next timer once all the goroutines are blocked.
+type simClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    int
+	timers []*simTimer
+}
+
+type simTimer struct {
+	clock *simClock
+	when  time.Time
+	seq   int // timers with the same time fire in creation order
+	f     func()
+}
+
+func newSimClock() *simClock { return &simClock{now: simEpoch} }
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &simTimer{clock: c, when: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *simTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, x := range c.timers {
+		if x == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// run fires the timers in time order, each one after all the goroutines
+// of the synctest bubble are blocked. It returns when no timer is left.
+func (c *simClock) run() {
+	for {
+		synctest.Wait()
+
+		c.mu.Lock()
+		if len(c.timers) == 0 {
+			c.mu.Unlock()
+			return
+		}
+		sort.Slice(c.timers, func(i, j int) bool {
+			a, b := c.timers[i], c.timers[j]
+			if a.when.Equal(b.when) {
+				return a.seq < b.seq
+			}
+			return a.when.Before(b.when)
+		})
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.mu.Unlock()
+
+		t.f()
+	}
+}
+
+// simStep is the scripted latency and outcome of a request.
+type simStep struct {
+	latency time.Duration
+	fail    bool
+}
+
+type simKey struct {
+	job    string
+	worker string
+}
+
+// simulation replays a scripted scenario with a virtual clock,
+// recording the job completions and the task events.
+type simulation struct {
+	NopObserver
+	clock  *simClock
+	script map[simKey]simStep
+
+	mu        sync.Mutex
+	completed []string // "job@time" in completion order
+	started   int
+	cancelled int
+	attempts  map[simKey]int
+}
+
+func newSimulation(script map[simKey]simStep) *simulation {
+	return &simulation{clock: newSimClock(), script: script, attempts: map[simKey]int{}}
+}
+
+func (s *simulation) TaskStarted(TaskEvent) {
+	s.mu.Lock()
+	s.started++
+	s.mu.Unlock()
+}
+
+func (s *simulation) TaskCancelled(TaskEvent) {
+	s.mu.Lock()
+	s.cancelled++
+	s.mu.Unlock()
+}
+
+func (s *simulation) JobCompleted(ev JobEvent) {
+	status := "ok"
+	if !ev.Response.Success() {
+		status = "err"
+	}
+	s.mu.Lock()
+	s.completed = append(s.completed, fmt.Sprintf("%s@%v:%s", ev.Job, ev.Time.Sub(simEpoch), status))
+	s.mu.Unlock()
+}
+
+// work is the WorkFunc of the scripted requests.
+func (s *simulation) work(ctx context.Context, req Request) Response {
+	key := simKey{string(req.JobID()), string(req.WorkerID())}
+	step := s.script[key]
+	s.mu.Lock()
+	s.attempts[key]++
+	s.mu.Unlock()
+	res := &testResponse{jobid: string(req.JobID()), workerid: string(req.WorkerID())}
+	if err := sleep(ctx, s.clock, step.latency); err != nil {
+		res.err = err
+		return res
+	}
+	if step.fail {
+		res.err = errors.New("ERR")
+	}
+	return res
+}
+
+// run executes the requests in a synctest bubble, until all the jobs are done.
+// The Work function of the workers is replaced by the script.
+func (s *simulation) run(t *testing.T, workers []*Worker, requests []Request, opts ...Option) {
+	synctest.Test(t, func(t *testing.T) {
+		for _, w := range workers {
+			w.Work = s.work
+		}
+		opts = append(opts, WithClock(s.clock), Observe(s))
+		out, err := Execute(context.Background(), workers, requests, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() {
+			for range out {
+			}
+			close(done)
+		}()
+		s.clock.run()
+		<-done
+	})
+}
+
+func simWorkers(instances ...int) []*Worker {
+	workers := make([]*Worker, 0, len(instances))
+	for j, n := range instances {
+		workers = append(workers, &Worker{WorkerID: WorkerKey(fmt.Sprintf("worker_%d", j+1)), Instances: n})
+	}
+	return workers
+}
+
+func simRequests(order ...simKey) []Request {
+	requests := make([]Request, 0, len(order))
+	for _, k := range order {
+		requests = append(requests, &testRequest{jobid: k.job, workerid: k.worker})
+	}
+	return requests
+}
+
+func TestSimulation(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	k := func(job, worker int) simKey {
+		return simKey{fmt.Sprintf("job_%d", job), fmt.Sprintf("worker_%d", worker)}
+	}
+	script := map[simKey]simStep{
+		k(1, 1): {latency: ms(100)},
+		k(1, 2): {latency: ms(30), fail: true},
+		k(2, 1): {latency: ms(10)},
+		k(2, 2): {latency: ms(50)},
+		k(3, 2): {latency: ms(20), fail: true},
+	}
+	order := []simKey{k(1, 1), k(1, 2), k(2, 1), k(2, 2), k(3, 2)}
+
+	testCases := map[string]struct {
+		opts      []Option
+		completed []string
+		started   int
+		cancelled int
+	}{
+		// worker_1: job_1 (0-100), job_2 skipped
+		// worker_2: job_1 fails (0-30), job_2 (30-80), job_3 fails (80-100)
+		"fifo": {
+			opts:      []Option{Ordering(FIFO{})},
+			completed: []string{"job_2@80ms:ok", "job_1@100ms:ok", "job_3@100ms:err"},
+			started:   4,
+			cancelled: 1,
+		},
+		// worker_1: job_1 (0-100), job_2 cancelled (100-100)
+		// worker_2: job_3 fails (0-20), job_1 fails (20-50), job_2 (50-100)
+		"preference": {
+			opts:      []Option{Ordering(Preference{})},
+			completed: []string{"job_3@20ms:err", "job_1@100ms:ok", "job_2@100ms:ok"},
+			started:   5,
+			cancelled: 1,
+		},
+		// deadlines at 90ms from the submission
+		// worker_1: job_1 cancelled (0-90), job_2 skipped
+		// worker_2: job_1 fails (0-30), job_2 (30-80), job_3 cancelled (80-90)
+		"timeout": {
+			opts:      []Option{Ordering(FIFO{}), JobTimeout(ms(90))},
+			completed: []string{"job_2@80ms:ok", "job_1@90ms:err", "job_3@90ms:err"},
+			started:   4,
+			cancelled: 3,
+		},
+		// worker_1: job_1 (0-100), job_2 (100-110)
+		// worker_2: job_3 fails (0-20), job_1 hedged at 5ms fails (20-50),
+		// job_2 hedged at 105ms cancelled (105-110)
+		"hedge": {
+			opts:      []Option{Hedge(HedgePolicy{Delay: ms(5)})},
+			completed: []string{"job_3@20ms:err", "job_1@100ms:ok", "job_2@110ms:ok"},
+			started:   5,
+			cancelled: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s := newSimulation(script)
+			s.run(t, simWorkers(1, 1), simRequests(order...), tc.opts...)
+			if !reflect.DeepEqual(s.completed, tc.completed) {
+				t.Errorf("completed: expected %v, found %v", tc.completed, s.completed)
+			}
+			if s.started != tc.started {
+				t.Errorf("started: expected %d, found %d", tc.started, s.started)
+			}
+			if s.cancelled != tc.cancelled {
+				t.Errorf("cancelled: expected %d, found %d", tc.cancelled, s.cancelled)
+			}
+		})
+	}
+}
+
+func TestSimulationQueuedTimeout(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	script := map[simKey]simStep{
+		{"job_1", "worker_1"}: {latency: ms(100)},
+		{"job_2", "worker_1"}: {latency: ms(10)},
+	}
+
+	// job_2 times out while queued behind job_1,
+	// instead of running 100-110 with a deadline from its start
+	s := newSimulation(script)
+	s.run(t, simWorkers(1), simRequests(simKey{"job_1", "worker_1"}, simKey{"job_2", "worker_1"}), JobTimeout(ms(50)))
+	if expected := []string{"job_1@50ms:err", "job_2@50ms:err"}; !reflect.DeepEqual(s.completed, expected) {
+		t.Errorf("completed: expected %v, found %v", expected, s.completed)
+	}
+}
+
+func TestSimulationRetryCancelled(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	failing := simKey{"job_1", "worker_1"}
+	script := map[simKey]simStep{
+		failing:               {latency: ms(1), fail: true},
+		{"job_1", "worker_2"}: {latency: ms(10)},
+	}
+	workers := simWorkers(1, 1)
+	workers[0].Retry = RetryPolicy{MaxAttempts: 5, Backoff: ms(100)}
+
+	// the pending retry of worker_1 is cancelled by the success of worker_2
+	s := newSimulation(script)
+	s.run(t, workers, simRequests(failing, simKey{"job_1", "worker_2"}))
+	if expected := []string{"job_1@10ms:ok"}; !reflect.DeepEqual(s.completed, expected) {
+		t.Errorf("completed: expected %v, found %v", expected, s.completed)
+	}
+	if n := s.attempts[failing]; n != 1 {
+		t.Errorf("worker_1 attempts: expected 1, found %d", n)
+	}
+}
+
+func TestSimulationInflightBackoff(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	script := map[simKey]simStep{
+		{"job_1", "worker_1"}: {latency: ms(10), fail: true},
+		{"job_2", "worker_2"}: {latency: ms(10)},
+		{"job_3", "worker_2"}: {latency: ms(10)},
+	}
+	workers := simWorkers(1, 1)
+	workers[0].Retry = RetryPolicy{MaxAttempts: 2, Backoff: ms(100)}
+	requests := simRequests(simKey{"job_1", "worker_1"}, simKey{"job_2", "worker_2"}, simKey{"job_3", "worker_2"})
+
+	// whichever worker starts first, worker_1 gives back the only slot
+	// during its backoff, so worker_2 completes its jobs by 30ms
+	s := newSimulation(script)
+	s.run(t, workers, requests, MaxInFlight(1))
+	found := false
+	for _, c := range s.completed {
+		found = found || c == "job_3@30ms:ok"
+	}
+	if !found {
+		t.Errorf("completed: expected job_3@30ms:ok, found %v", s.completed)
+	}
+}
+
+func TestSimulationSeed(t *testing.T) {
+	script := map[simKey]simStep{}
+	var order []simKey
+	for j := 1; j <= 5; j++ {
+		for w := 1; w <= 2; w++ {
+			k := simKey{fmt.Sprintf("job_%d", j), fmt.Sprintf("worker_%d", w)}
+			script[k] = simStep{latency: time.Duration(10*j+w) * time.Millisecond, fail: (j+w)%3 == 0}
+			order = append(order, k)
+		}
+	}
+	completed := func(seed int64) []string {
+		workers := simWorkers(1, 1)
+		for _, w := range workers {
+			w.RateLimit = RateLimit{MinDelay: 5 * time.Millisecond, Jitter: 20 * time.Millisecond}
+			w.Retry = RetryPolicy{MaxAttempts: 2, Backoff: 10 * time.Millisecond, Jitter: 10 * time.Millisecond}
+		}
+		s := newSimulation(script)
+		s.run(t, workers, simRequests(order...), Ordering(FIFO{}), Seed(seed))
+		return s.completed
+	}
+
+	// the same seed gives the same run
+	first := completed(1)
+	if second := completed(1); !reflect.DeepEqual(first, second) {
+		t.Errorf("expected %v, found %v", first, second)
+	}
+	if len(first) != 5 {
+		t.Errorf("expected 5 jobs completed, found %v", first)
+	}
+}
@@ -0,0 +1,93 @@
+package workers
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Strategy defines the order in which the requests are worked.
+type Strategy interface {
+	// Order groups the requests by worker. Each worker list is in the order
+	// the requests will be worked. The requests are passed in submission order.
+	Order(requests []Request) map[WorkerKey][]Request
+}
+
+// Distribute is the default Strategy. It spreads the requests of each job
+// among the workers, in order to complete each job as soon as possible.
+// Jobs with fewer requests come first.
+type Distribute struct{}
+
+// Random is the Strategy that randomly permutes each worker's requests.
+type Random struct {
+	// Rand is the source of the permutations.
+	// If nil, the global source of math/rand is used.
+	// It must not be shared with other goroutines.
+	Rand *rand.Rand
+}
+
+// FIFO is the Strategy that works the requests in submission order.
+type FIFO struct{}
+
+// Preference is the Strategy that works the requests by the preference
+// of their source within the job: the first request of every job comes
+// before the second request of any job, and so on.
+// Requests with the same preference are in submission order.
+type Preference struct{}
+
+// Order implements the Strategy interface.
+func (Distribute) Order(requests []Request) map[WorkerKey][]Request {
+	return distribute(requests)
+}
+
+// Order implements the Strategy interface.
+func (s Random) Order(requests []Request) map[WorkerKey][]Request {
+	wr := groupByWorker(requests)
+	if s.Rand != nil {
+		wr.randomize(s.Rand.Perm)
+	} else {
+		wr.randomize(rand.Perm)
+	}
+	return wr
+}
+
+// Order implements the Strategy interface.
+func (FIFO) Order(requests []Request) map[WorkerKey][]Request {
+	return groupByWorker(requests)
+}
+
+// Order implements the Strategy interface.
+func (Preference) Order(requests []Request) map[WorkerKey][]Request {
+	// rank of each request within its job
+	rank := make([]int, len(requests))
+	count := map[JobKey]int{}
+	// indexes of the requests of each worker
+	idx := map[WorkerKey][]int{}
+	for i, r := range requests {
+		jid, wid := r.JobID(), r.WorkerID()
+		rank[i] = count[jid]
+		count[jid]++
+		idx[wid] = append(idx[wid], i)
+	}
+
+	wr := mapWorkerRequests{}
+	for wid, a := range idx {
+		sort.SliceStable(a, func(i, j int) bool { return rank[a[i]] < rank[a[j]] })
+		reqs := make([]Request, 0, len(a))
+		for _, i := range a {
+			reqs = append(reqs, requests[i])
+		}
+		wr[wid] = reqs
+	}
+	return wr
+}
+
+// groupByWorker returns the requests grouped by worker,
+// keeping their order.
+func groupByWorker(requests []Request) mapWorkerRequests {
+	wr := mapWorkerRequests{}
+	for _, r := range requests {
+		wid := r.WorkerID()
+		wr[wid] = append(wr[wid], r)
+	}
+	return wr
+}
@@ -0,0 +1,117 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// strategyRequests returns two requests for each job:
+// odd jobs prefer worker_1, even jobs prefer worker_2.
+func strategyRequests(jobs int, msec int) []Request {
+	var requests []Request
+	for j := 1; j <= jobs; j++ {
+		jid := fmt.Sprintf("job_%d", j)
+		w1, w2 := "worker_1", "worker_2"
+		if j%2 == 0 {
+			w1, w2 = w2, w1
+		}
+		requests = append(requests,
+			&testRequest{jobid: jid, workerid: w1, minMsec: msec, maxMsec: msec},
+			&testRequest{jobid: jid, workerid: w2, minMsec: msec, maxMsec: msec},
+		)
+	}
+	return requests
+}
+
+func orderedJobs(wr map[WorkerKey][]Request) map[WorkerKey][]JobKey {
+	res := map[WorkerKey][]JobKey{}
+	for wid, reqs := range wr {
+		for _, r := range reqs {
+			res[wid] = append(res[wid], r.JobID())
+		}
+	}
+	return res
+}
+
+func TestStrategyOrder(t *testing.T) {
+	requests := strategyRequests(4, 0)
+
+	testCases := map[string]struct {
+		strategy Strategy
+		expected map[WorkerKey][]JobKey
+	}{
+		"FIFO": {FIFO{}, map[WorkerKey][]JobKey{
+			"worker_1": {"job_1", "job_2", "job_3", "job_4"},
+			"worker_2": {"job_1", "job_2", "job_3", "job_4"},
+		}},
+		"Preference": {Preference{}, map[WorkerKey][]JobKey{
+			"worker_1": {"job_1", "job_3", "job_2", "job_4"},
+			"worker_2": {"job_2", "job_4", "job_1", "job_3"},
+		}},
+	}
+	for name, tc := range testCases {
+		if found := orderedJobs(tc.strategy.Order(requests)); !reflect.DeepEqual(found, tc.expected) {
+			t.Errorf("%s: expected %v, found %v", name, tc.expected, found)
+		}
+	}
+
+	// the other strategies must keep all the requests
+	for _, s := range []Strategy{Distribute{}, Random{}} {
+		n := 0
+		for _, reqs := range s.Order(requests) {
+			n += len(reqs)
+		}
+		if n != len(requests) {
+			t.Errorf("%T: expected %d requests, found %d", s, len(requests), n)
+		}
+	}
+}
+
+// firstResultTime returns the mean time to the result of each job.
+func firstResultTime(t *testing.T, s Strategy, requests []Request) time.Duration {
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 1, Work: fnWork},
+		{WorkerID: "worker_2", Instances: 1, Work: fnWork},
+	}
+	start := time.Now()
+	out, err := Execute(context.Background(), workers, requests, Ordering(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total time.Duration
+	n := 0
+	for res := range out {
+		if !res.Success() {
+			t.Errorf("%T: unexpected failure %v", s, res)
+		}
+		total += time.Since(start)
+		n++
+	}
+	return total / time.Duration(n)
+}
+
+func TestStrategyFirstResult(t *testing.T) {
+	requests := strategyRequests(4, 30)
+
+	times := map[string]time.Duration{}
+	for name, s := range map[string]Strategy{
+		"Distribute": Distribute{},
+		"Random":     Random{},
+		"FIFO":       FIFO{},
+		"Preference": Preference{},
+	} {
+		times[name] = firstResultTime(t, s, requests)
+		t.Logf("%-10s mean time to first result: %v", name, times[name])
+	}
+
+	// FIFO works each job on both workers at the same time
+	if times["Distribute"] >= times["FIFO"] {
+		t.Errorf("Distribute (%v) expected faster than FIFO (%v)", times["Distribute"], times["FIFO"])
+	}
+	if times["Preference"] >= times["FIFO"] {
+		t.Errorf("Preference (%v) expected faster than FIFO (%v)", times["Preference"], times["FIFO"])
+	}
+}
@@ -0,0 +1,73 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedWorkFunc is the worker function with typed request and response.
+type TypedWorkFunc[Req Request, Res Response] func(context.Context, Req) Res
+
+// TypedWorker is a Worker whose Work function has typed request and response.
+// The Work field of the embedded Worker is ignored.
+type TypedWorker[Req Request, Res Response] struct {
+	Worker
+	Work TypedWorkFunc[Req, Res]
+}
+
+// Adapt returns the Worker calling the typed Work function.
+func (w *TypedWorker[Req, Res]) Adapt() *Worker {
+	wrk := w.Worker
+	wrk.Work = nil
+	if work := w.Work; work != nil {
+		wrk.Work = func(ctx context.Context, req Request) Response {
+			return work(ctx, req.(Req))
+		}
+	}
+	return &wrk
+}
+
+// TypedResult is the typed response of a job.
+type TypedResult[Res Response] struct {
+	Job JobKey
+	// Response of the job, if returned by a Work function or by the reducer.
+	Response Res
+	// Err is the error of a job without such a response,
+	// e.g. a *JobError, *TaskError or *PanicError.
+	Err error
+}
+
+// Success reports whether the job succeeded.
+func (r *TypedResult[Res]) Success() bool { return r.Err == nil && r.Response.Success() }
+
+// ExecuteTyped is the type safe version of Execute.
+// It works the typed requests with the typed workers,
+// and sends the result of each job to the returned channel.
+// The channel is closed once all the jobs are done.
+func ExecuteTyped[Req Request, Res Response](ctx context.Context, workers []*TypedWorker[Req, Res], requests []Req, opts ...Option) (chan TypedResult[Res], error) {
+	wrks := make([]*Worker, 0, len(workers))
+	for _, w := range workers {
+		wrks = append(wrks, w.Adapt())
+	}
+	reqs := make([]Request, 0, len(requests))
+	for _, r := range requests {
+		reqs = append(reqs, r)
+	}
+
+	out := make(chan TypedResult[Res])
+	notify := func(res *JobResult) { out <- typedResult[Res](res.Job, res.Response) }
+	if err := execute(ctx, wrks, reqs, opts, notify, func() { close(out) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func typedResult[Res Response](job JobKey, res Response) TypedResult[Res] {
+	switch r := res.(type) {
+	case Res:
+		return TypedResult[Res]{Job: job, Response: r}
+	case error:
+		return TypedResult[Res]{Job: job, Err: r}
+	}
+	return TypedResult[Res]{Job: job, Err: fmt.Errorf("Unexpected response type %T: job=%q", res, job)}
+}
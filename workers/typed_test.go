@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func typedWork(ctx context.Context, req *testRequest) *testResponse {
+	return fnWork(ctx, req).(*testResponse)
+}
+
+func TestExecuteTyped(t *testing.T) {
+	workers := []*TypedWorker[*testRequest, *testResponse]{
+		{Worker: Worker{WorkerID: "worker_1", Instances: 1}, Work: typedWork},
+		{Worker: Worker{WorkerID: "worker_2", Instances: 1}, Work: typedWork},
+	}
+	requests := []*testRequest{
+		{jobid: "job_1", workerid: "worker_1"},
+		{jobid: "job_1", workerid: "worker_2"},
+		{jobid: "job_2", workerid: "worker_2", percErr: 100},
+		// job_3 times out
+		{jobid: "job_3", workerid: "worker_1", minMsec: 500, maxMsec: 500},
+	}
+
+	out, err := ExecuteTyped(context.Background(), workers, requests, JobTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[JobKey]TypedResult[*testResponse]{}
+	for r := range out {
+		results[r.Job] = r
+	}
+
+	if r := results["job_1"]; !r.Success() || r.Response.jobid != "job_1" {
+		t.Errorf("job_1: expected success, found %+v", r)
+	}
+	if r := results["job_2"]; r.Success() || r.Err != nil || r.Response.err == nil {
+		t.Errorf("job_2: expected failed response, found %+v", r)
+	}
+	if r := results["job_3"]; !errors.Is(r.Err, ErrJobTimeout) {
+		t.Errorf("job_3: expected %v, found %+v", ErrJobTimeout, r)
+	}
+}
@@ -3,7 +3,6 @@ package workers
 import (
 	"bytes"
 	"fmt"
-	"math/rand"
 	"sort"
 	"strings"
 )
@@ -40,18 +39,25 @@ func (wr mapWorkerRequests) String() string {
 // ============================================================================
 
 // randomize randomly permutes each worker's list of Requests
-func (wr mapWorkerRequests) randomize() {
+// using the perm function (e.g. rand.Perm).
+// The workers are permuted in key order, so a seeded perm function
+// gives the same result each time.
+func (wr mapWorkerRequests) randomize(perm func(int) []int) {
 	shuffleRequests := func(src []Request) []Request {
 		dest := make([]Request, len(src))
-		perm := rand.Perm(len(src))
-		for i, v := range perm {
+		for i, v := range perm(len(src)) {
 			dest[v] = src[i]
 		}
 		return dest
 	}
 
-	for wid, items := range wr {
-		wr[wid] = shuffleRequests(items)
+	wids := make([]string, 0, len(wr))
+	for wid := range wr {
+		wids = append(wids, string(wid))
+	}
+	sort.Strings(wids)
+	for _, wid := range wids {
+		wr[WorkerKey(wid)] = shuffleRequests(wr[WorkerKey(wid)])
 	}
 }
 
@@ -59,109 +65,48 @@ func (wr mapWorkerRequests) randomize() {
 // DISTRIBUTE
 // ============================================================================
 
-type mapJobWorkers map[JobKey][]WorkerKey
-
-type jobInfo struct {
-	jobkey  JobKey
-	workers int
-}
-type byLen []jobInfo
-
-func (a byLen) Len() int           { return len(a) }
-func (a byLen) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byLen) Less(i, j int) bool { return a[i].workers < a[j].workers }
-
-// jobWorkers returns the jobWorkers map
-func (wr mapWorkerRequests) jobWorkers() mapJobWorkers {
-	jw := mapJobWorkers{}
-	for wid, reqs := range wr {
-		for _, r := range reqs {
-			jid := r.JobID()
-			if wids, ok := jw[jid]; ok {
-				jw[jid] = append(wids, wid)
-			} else {
-				jw[jid] = []WorkerKey{wid}
-			}
+// distribute returns the requests grouped by worker, ordered in order to
+// have each job as soon as possible. At each pass, every job gives one of
+// its requests to the candidate worker with the shortest list,
+// the jobs with fewer requests first.
+// Each pass takes one request from every job, so the order of the jobs
+// doesn't change between passes and is computed once.
+func distribute(requests []Request) mapWorkerRequests {
+	// requests of each job, with the jobs in submission order
+	index := map[JobKey]int{}
+	var jobs [][]Request
+	for _, r := range requests {
+		j, ok := index[r.JobID()]
+		if !ok {
+			j = len(jobs)
+			index[r.JobID()] = j
+			jobs = append(jobs, nil)
 		}
+		jobs[j] = append(jobs[j], r)
 	}
-	//for _, w := range jw {
-	//sort.Strings(w)
-	//}
-	return jw
-}
-
-// jobOrder returns a job key list
-// ordered with the jobs with fewer requests first.
-func (jw mapJobWorkers) jobOrder() []JobKey {
-	// creates the jobInfo list
-	var list = make([]jobInfo, 0, len(jw))
-	for jid, wids := range jw {
-		list = append(list, jobInfo{jid, len(wids)})
-	}
-	sort.Sort(byLen(list))
-	a := make([]JobKey, 0, len(jw))
-	for _, jobinfo := range list {
-		a = append(a, jobinfo.jobkey)
-	}
-	return a
-}
-
-// distribute reorder each worker requests list,
-// in order to have each job as soon as possible
-func (src mapWorkerRequests) distribute() {
-	// initialize dst
-	dst := mapWorkerRequests{}
-	for wid := range src {
-		dst[wid] = []Request{}
-	}
-
-	for {
-		jw := src.jobWorkers()
-		ord := jw.jobOrder()
-		if len(ord) == 0 {
-			break
-		}
-
-		for _, jid := range ord {
-
-			// list of candidate workers of the job
-			wids := jw[jid]
-
-			// select the worker with the dst shorter list of job
-			var minlen, minidx int
-			for idx, wid := range wids {
-				l := len(dst[wid])
-				if idx == 0 || l < minlen {
-					minlen = l
-					minidx = idx
+	sort.SliceStable(jobs, func(i, j int) bool { return len(jobs[i]) < len(jobs[j]) })
+
+	wr := mapWorkerRequests{}
+	for len(jobs) > 0 {
+		left := jobs[:0]
+		for _, reqs := range jobs {
+			// select the worker with the shorter list
+			k := 0
+			for idx := 1; idx < len(reqs); idx++ {
+				if len(wr[reqs[idx].WorkerID()]) < len(wr[reqs[k].WorkerID()]) {
+					k = idx
 				}
 			}
-			wid := wids[minidx]
+			wid := reqs[k].WorkerID()
+			wr[wid] = append(wr[wid], reqs[k])
 
-			// remove the worker from the job's worker list
-			wids[minidx] = wids[len(wids)-1]
-			wids = wids[:len(wids)-1]
-			jw[jid] = wids
-
-			// remove the request from the src worker's request list
-			// and insert into the dst worker's request  list
-			reqs := src[wid]
-			for idx, req := range reqs {
-				if req.JobID() == jid {
-					// insert the request in dst
-					dst[wid] = append(dst[wid], req)
-					// remove the request from src
-					reqs[idx] = reqs[len(reqs)-1]
-					reqs = reqs[:len(reqs)-1]
-					src[wid] = reqs
-
-					break
-				}
+			// remove the request from the job
+			reqs = append(reqs[:k], reqs[k+1:]...)
+			if len(reqs) > 0 {
+				left = append(left, reqs)
 			}
-
 		}
+		jobs = left
 	}
-	for wid := range src {
-		src[wid] = dst[wid]
-	}
+	return wr
 }
@@ -2,8 +2,12 @@ package workers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Max number of instances for each worker
@@ -34,6 +38,48 @@ type Response interface {
 	Success() bool
 }
 
+// Causes of the cancellation of a job context, as returned by context.Cause
+// on the context passed to the Work function.
+var (
+	// ErrJobTimeout is the error of a job whose deadline expired.
+	ErrJobTimeout = errors.New("Job timeout")
+	// ErrSiblingSucceeded is the cause of the requests cancelled
+	// because other requests of the job succeeded.
+	ErrSiblingSucceeded = errors.New("Sibling succeeded")
+	// ErrRunCancelled is the cause of the requests cancelled
+	// because the context passed to Execute or Submit is done.
+	ErrRunCancelled = errors.New("Run cancelled")
+)
+
+// JobError is the Response of a job terminated
+// before any of its requests returned a response.
+type JobError struct {
+	Job JobKey
+	Err error
+}
+
+func (e *JobError) Error() string { return fmt.Sprintf("%s: job=%q", e.Err, e.Job) }
+func (e *JobError) Unwrap() error { return e.Err }
+
+// Success always returns false.
+func (e *JobError) Success() bool { return false }
+
+// PanicError is the Response of a request whose Work function panicked.
+type PanicError struct {
+	Request Request
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Panic: %v: worker=%q, job=%q", e.Value, e.Request.WorkerID(), e.Request.JobID())
+}
+
+// Success always returns false.
+func (e *PanicError) Success() bool { return false }
+
 // WorkFunc is the worker function.
 type WorkFunc func(context.Context, Request) Response
 
@@ -42,199 +88,233 @@ type Worker struct {
 	WorkerID  WorkerKey
 	Instances int
 	Work      WorkFunc
+	// RateLimit is the rate policy shared by all the instances of the worker.
+	RateLimit RateLimit
+	// Retry is the retry policy of the failed requests.
+	Retry RetryPolicy
+	// Timeout is the max duration of each attempt of a request.
+	// Zero means no timeout.
+	Timeout time.Duration
+	// CircuitBreaker is the circuit breaker policy of the worker.
+	CircuitBreaker CircuitBreaker
+	// Scaling is the adaptive scaling policy of the instances of the worker.
+	Scaling Scaling
+	// Exhausted reports whether a failed response means that the quota
+	// of the worker is exhausted: the following requests of the worker
+	// fail at once with a *TaskError wrapping ErrQuotaExhausted.
+	// The response is not counted by the circuit breaker and the scaling.
+	Exhausted func(Response) bool
+	// Neutral reports whether a failed response doesn't depend on the
+	// health of the worker, e.g. an item missing from a page downloaded
+	// successfully: it is not counted by the circuit breaker and the scaling.
+	Neutral func(Response) bool
 }
 
 //-----------------------------------------------------------------------------
 
 type jobContextItem struct {
-	workers int
-	ctx     context.Context
-	cancel  context.CancelFunc
-	resChan chan Response
+	id       JobKey
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	unlink   func() bool // stops the cancellation by the run context
+	requests []Request   // in submission order
+	future   *Future
+	notify   func(*JobResult)
+	done     atomic.Bool // job complete
+
+	// responses received, owned by the collector
+	remaining int
+	last      Response
+	successes []Response
+	completed bool
+
+	// requests not yet started in hedging mode,
+	// and attempts of the queued requests
+	mu       sync.Mutex
+	pending  []Request
+	attempts []*Attempt
+
+	// job deadline
+	timeout time.Duration
+	once    sync.Once
+	clock   Clock
+	timer   Timer
 }
 
-type dispatcher struct {
-	workerMap      map[WorkerKey]*Worker
-	workerRequests mapWorkerRequests
-	jobContext     map[JobKey]*jobContextItem
+type workerContextItem struct {
+	*Worker
+	limiter   *rateLimiter
+	breaker   *circuitBreaker
+	scaler    *scaler
+	inflight  *inflightLimiter // shared by all the workers of the Pool
+	latencies latencyTracker
+	clock     Clock
+	rand      *randSource
+	exhausted atomic.Bool // the quota of the worker is exhausted
 }
 
 type task struct {
-	ctx     context.Context
+	job     *jobContextItem
 	req     Request
-	resChan chan Response
+	attempt *Attempt
 }
 
-//func (d *dispatcher) jobs() int {
-//return len(d.jobContext)
-//}
-
-//func (d *dispatcher) workers() int {
-//return len(d.workerQueue)
-//}
-
-func newBasicDispatcher(ctx context.Context, workers []*Worker, requests []Request) (*dispatcher, error) {
-
-	// check workers and map form workerid to Worker
-	wm := map[WorkerKey]*Worker{}
-	for _, w := range workers {
-		if _, ok := wm[w.WorkerID]; ok {
-			return nil, fmt.Errorf("Duplicate worker: %q", w.WorkerID)
+// work executes the task, once the rate policy of the worker allows it
+// and a slot of the MaxInFlight limit, if any, is free.
+// In case the job context is done while waiting for the rate limit,
+// the Work function is called anyway to get the response.
+// A failed request is retried according to the retry policy of the worker,
+// until the job context is done.
+// If the quota of the worker is exhausted or its circuit breaker is open,
+// it returns a *TaskError at once.
+func (w *workerContextItem) work(t *task) Response {
+	ctx := t.job.ctx
+	var res Response
+	for attempt := 1; ; attempt++ {
+		if w.exhausted.Load() {
+			return &TaskError{Request: t.req, Err: ErrQuotaExhausted}
 		}
-		if w.Instances <= 0 || w.Instances > maxInstances {
-			return nil, fmt.Errorf("Instances must be in 1..%d range: worker=%q", maxInstances, w.WorkerID)
+		ok, probe := w.breaker.allow(w.clock.Now())
+		if !ok {
+			return &TaskError{Request: t.req, Err: ErrCircuitOpen}
 		}
-		if w.Work == nil {
-			return nil, fmt.Errorf("Work function cannot be nil: worker=%q", w.WorkerID)
+		w.limiter.wait(ctx, w.clock)
+		// the slot is held by the attempt only, not by the waits
+		if err := w.inflight.acquire(ctx, w.WorkerID); err != nil {
+			w.breaker.release(probe)
+			if res == nil {
+				res = &TaskError{Request: t.req, Err: t.job.err()}
+			}
+			return res
 		}
-		wm[w.WorkerID] = w
-	}
-
-	d := &dispatcher{
-		workerMap:      wm,
-		workerRequests: mapWorkerRequests{},
-		jobContext:     map[JobKey]*jobContextItem{},
-	}
-
-	// check requests and init dispatcher
-	for _, r := range requests {
-
-		// updates worker queue
-		wid := r.WorkerID()
-		// get the worker queue, if exists
-		if wr, ok := d.workerRequests[wid]; ok {
-			// append the new request to the queue
-			d.workerRequests[wid] = append(wr, r)
+		start := w.clock.Now()
+		res = w.attempt(ctx, t.req)
+		w.inflight.release(w.WorkerID)
+		if ctx.Err() != nil {
+			// cancelled: the response doesn't depend on the worker
+			w.breaker.release(probe)
+			return res
+		}
+		if !res.Success() && w.Exhausted != nil && w.Exhausted(res) {
+			// the next requests of the worker are not worked
+			w.exhausted.Store(true)
+			w.breaker.release(probe)
+			return res
+		}
+		if !res.Success() && w.Neutral != nil && w.Neutral(res) {
+			// the failure doesn't depend on the worker
+			w.breaker.release(probe)
 		} else {
-			// check if the worker exists
-			if _, ok := wm[wid]; !ok {
-				return nil, fmt.Errorf("Worker not found: worker=%q, job=%q", wid, r.JobID())
-			}
-			// create the worker queue
-			d.workerRequests[wid] = []Request{r}
+			end := w.clock.Now()
+			w.breaker.record(end, res.Success(), probe)
+			w.scaler.record(start, end, res.Success())
 		}
-
-		// updates job contexts
-		jid := r.JobID()
-		jc := d.jobContext[jid]
-		if jc == nil {
-			jc = &jobContextItem{}
-			d.jobContext[jid] = jc
-			// create the job context and cancel function
-			jc.ctx, jc.cancel = context.WithCancel(ctx)
-			// in case of buffered chan, can't create here the resChan
-			//jc.resChan = make(chan Response) // see below
+		if res.Success() || !w.Retry.retry(attempt, res) {
+			return res
+		}
+		if err := sleep(ctx, w.clock, w.Retry.backoff(attempt, w.rand)); err != nil {
+			return res
 		}
-		// NOTE: doesn't check if the worker has already been used for the same job
-		jc.workers = jc.workers + 1
-
-	}
-
-	// create the resChan buffered channel for each job
-	for _, jc := range d.jobContext {
-		jc.resChan = make(chan Response, jc.workers)
 	}
-
-	return d, nil
 }
 
-// genTaskChan returns a chan where are enqueued the task for the worker
-func (d *dispatcher) genTaskChan(wid WorkerKey) chan *task {
-	out := make(chan *task)
-	go func() {
-		for _, item := range d.workerRequests[wid] {
-			jc := d.jobContext[item.JobID()]
-			wreq := &task{
-				ctx:     jc.ctx,
-				resChan: jc.resChan,
-				req:     item,
-			}
-			out <- wreq
+// attempt works the request once, within the worker timeout if any.
+// A panic of the Work function is returned as a *PanicError.
+func (w *workerContextItem) attempt(ctx context.Context, req Request) (res Response) {
+	defer func() {
+		if v := recover(); v != nil {
+			res = &PanicError{Request: req, Value: v, Stack: debug.Stack()}
 		}
-		close(out)
 	}()
-	return out
-}
-
-func (jc *jobContextItem) getJobResponse(out chan Response) {
-	todo := true
-	count := jc.workers
-
-	for ; count > 0; count-- {
-
-		select {
-		case res := <-jc.resChan:
-			// if not already done,
-			// send the result if Success,
-			// or if it is the last result.
-			if todo && (res.Success() || count == 1) {
-				todo = false
-				jc.cancel()
-				out <- res
-				// XXX: inserted return statement: check it!!!
-				//return
-			}
-		case <-jc.ctx.Done():
-			jc.cancel()
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withTimeout(ctx, w.clock, w.Timeout)
+		defer cancel()
+	}
+	return w.Work(ctx, req)
+}
+
+// start starts the job deadline timer, once the job is submitted.
+// The expire function is called when the deadline expires.
+func (jc *jobContextItem) start(expire func()) {
+	jc.once.Do(func() {
+		if jc.timeout > 0 && jc.ctx.Err() == nil {
+			jc.timer = jc.clock.AfterFunc(jc.timeout, expire)
 		}
+	})
+}
+
+// stop stops the job deadline timer, or prevents it from starting.
+func (jc *jobContextItem) stop() {
+	jc.once.Do(func() {})
+	if jc.timer != nil {
+		jc.timer.Stop()
 	}
 }
 
-// Execute function is ...
-func Execute(ctx context.Context, workers []*Worker, requests []Request) (chan Response, error) {
+// err returns the cause of the cancellation of the job context.
+func (jc *jobContextItem) err() error {
+	return context.Cause(jc.ctx)
+}
 
-	// Create the dispatcher
-	d, err := newBasicDispatcher(ctx, workers, requests)
-	if err != nil {
+// Execute works the requests with the workers,
+// and sends the response of each job to the returned channel.
+// The channel is closed once all the jobs are done.
+// It is a shortcut for a Pool used for a single Submit.
+func Execute(ctx context.Context, workers []*Worker, requests []Request, opts ...Option) (chan Response, error) {
+	out := make(chan Response)
+	notify := func(res *JobResult) { out <- res.Response }
+	if err := execute(ctx, workers, requests, opts, notify, func() { close(out) }); err != nil {
 		return nil, err
 	}
-	//d.workerRequests.shuffle()
-	d.workerRequests.distribute()
+	return out, nil
+}
 
-	// Generate a task chan for each worker
-	reqChan := map[WorkerKey]chan *task{}
-	for wid := range d.workerRequests {
-		reqChan[wid] = d.genTaskChan(wid)
+// ExecuteVerbose is like Execute, but sends the result of each job,
+// with all its attempts, to the returned channel.
+func ExecuteVerbose(ctx context.Context, workers []*Worker, requests []Request, opts ...Option) (chan *JobResult, error) {
+	out := make(chan *JobResult)
+	notify := func(res *JobResult) { out <- res }
+	if err := execute(ctx, workers, requests, opts, notify, func() { close(out) }); err != nil {
+		return nil, err
 	}
+	return out, nil
+}
 
-	// Creates the output channel
-	out := make(chan Response)
+// execute submits the requests to a new Pool, calling notify with the result
+// of each job, and done once all the jobs are done.
+// The results are buffered, so a slow notify doesn't block the Pool.
+func execute(ctx context.Context, workers []*Worker, requests []Request, opts []Option, notify func(*JobResult), done func()) error {
 
-	// Starts a goroutine for each job to wait for the job response
-	var wg sync.WaitGroup
-	wg.Add(len(d.jobContext))
-	for _, jc := range d.jobContext {
-		go func(jc *jobContextItem) {
-			jc.getJobResponse(out)
-			wg.Done()
-		}(jc)
+	// Create the pool
+	p, err := NewPool(workers, opts...)
+	if err != nil {
+		return err
 	}
-	// Start a goroutine to close out once all the output goroutines are
-	// done.  This must start after the wg.Add call.
-	go func() {
-		wg.Wait()
-		//log.Println("CLOSING OUT")
-		close(out)
-	}()
 
-	// Starts the goroutines that executes the real work.
-	// For each worker it starts N goroutines, with N = Instances.
-	// Each goroutine get the input request from the worker request channel,
-	// and put the output response to the job response channel.
-	for wid, worker := range d.workerMap {
-		// get the request channel of the worker
-		reqc := reqChan[wid]
-		// for each worker instances
-		for i := 0; i < worker.Instances; i++ {
-
-			go func(w *Worker, input <-chan *task) {
-				for wreq := range input {
-					wreq.resChan <- w.Work(wreq.ctx, wreq.req)
-				}
-			}(worker, reqc)
+	// Submits the jobs
+	results := newResultQueue()
+	if _, err := p.submit(ctx, requests, results.push); err != nil {
+		p.Close()
+		return err
+	}
 
+	// Start a goroutine to close the results once all the jobs are done,
+	// and another one to notify them.
+	go func() {
+		p.Close()
+		results.close()
+	}()
+	go func() {
+		for {
+			res, ok := results.pop()
+			if !ok {
+				break
+			}
+			notify(res)
 		}
-	}
+		done()
+	}()
 
-	return out, nil
+	return nil
 }
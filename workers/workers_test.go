@@ -86,9 +86,9 @@ func TestExecute(t *testing.T) {
 	}
 
 	workers := []*Worker{
-		&Worker{"worker_1", 1, fnWork},
-		&Worker{"worker_2", 1, fnWork},
-		&Worker{"worker_3", 1, fnWork},
+		{WorkerID: "worker_1", Instances: 1, Work: fnWork},
+		{WorkerID: "worker_2", Instances: 1, Work: fnWork},
+		{WorkerID: "worker_3", Instances: 1, Work: fnWork},
 	}
 	/*
 		requests := []Request{
@@ -150,11 +150,6 @@ func TestPrioritize(t *testing.T) {
 		return Request(treq)
 	}
 
-	workers := []*Worker{
-		&Worker{"worker_1", 1, fnWork},
-		&Worker{"worker_2", 1, fnWork},
-		&Worker{"worker_3", 1, fnWork},
-	}
 	requests := []Request{
 		newreq("job_1", "worker_1"),
 		newreq("job_1", "worker_2"),
@@ -169,14 +164,126 @@ func TestPrioritize(t *testing.T) {
 		newreq("job_6", "worker_2"),
 		newreq("job_7", "worker_3"),
 	}
-	// Create the dispatcher
-	d, err := newBasicDispatcher(context.TODO(), workers, requests)
+	t.Logf("INPUT =  %s", groupByWorker(requests).String())
+	wr := distribute(requests)
+	t.Logf("OUTPUT =  %s", wr.String())
+
+}
+
+// sleepWork returns a work function that responds after d,
+// with an error if fail is true, or with the context error if done before.
+func sleepWork(d time.Duration, fail bool) WorkFunc {
+	return func(ctx context.Context, req Request) Response {
+		tres := &testResponse{
+			jobid:    string(req.JobID()),
+			workerid: string(req.WorkerID()),
+		}
+		select {
+		case <-ctx.Done():
+			tres.err = ctx.Err()
+		case <-time.After(d):
+			if fail {
+				tres.err = errors.New("ERR")
+			}
+		}
+		return tres
+	}
+}
+
+// executeAll calls Execute and collects the responses.
+func executeAll(t *testing.T, workers []*Worker, requests []Request, opts ...Option) []Response {
+	out, err := Execute(context.Background(), workers, requests, opts...)
 	if err != nil {
-		t.Error(err.Error())
-		return
+		t.Fatal(err)
+	}
+	var res []Response
+	for r := range out {
+		res = append(res, r)
+	}
+	return res
+}
+
+func TestWorkerTimeout(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 1, Work: sleepWork(time.Minute, false), Timeout: 50 * time.Millisecond},
+	}
+	requests := []Request{&testRequest{jobid: "job_1", workerid: "worker_1"}}
+
+	res := executeAll(t, workers, requests)
+	if len(res) != 1 {
+		t.Fatalf("expected 1 response, found %d", len(res))
 	}
-	t.Logf("INPUT =  %s", d.workerRequests.String())
-	d.workerRequests.distribute()
-	t.Logf("OUTPUT =  %s", d.workerRequests.String())
+	tres := res[0].(*testResponse)
+	if tres.err != context.DeadlineExceeded {
+		t.Errorf("expected %v, found %v", context.DeadlineExceeded, tres.err)
+	}
+}
 
+func TestJobTimeout(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "worker_1", Instances: 1, Work: sleepWork(10*time.Millisecond, true)},
+		{WorkerID: "worker_2", Instances: 1, Work: sleepWork(time.Minute, false)},
+	}
+	requests := []Request{
+		// job_1 gets the error response of worker_1 before the deadline
+		&testRequest{jobid: "job_1", workerid: "worker_1"},
+		&testRequest{jobid: "job_1", workerid: "worker_2"},
+		// job_2 gets no response before the deadline
+		&testRequest{jobid: "job_2", workerid: "worker_2"},
+	}
+
+	start := time.Now()
+	res := executeAll(t, workers, requests, JobTimeout(100*time.Millisecond))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("job deadline not enforced: elapsed %v", elapsed)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 responses, found %d", len(res))
+	}
+	for _, r := range res {
+		switch r := r.(type) {
+		case *testResponse:
+			if r.jobid != "job_1" || r.workerid != "worker_1" {
+				t.Errorf("unexpected response (%s, %s)", r.workerid, r.jobid)
+			}
+		case *JobError:
+			if r.Job != "job_2" || !errors.Is(r, ErrJobTimeout) {
+				t.Errorf("unexpected error %v", r)
+			}
+		default:
+			t.Errorf("unexpected response type %T", r)
+		}
+	}
+}
+
+func TestWorkPanic(t *testing.T) {
+	work := func(ctx context.Context, req Request) Response {
+		if req.JobID() == "job_1" {
+			var a []int
+			_ = a[5]
+		}
+		return fnWork(ctx, req)
+	}
+	// a single instance must work both requests
+	workers := []*Worker{{WorkerID: "worker_1", Instances: 1, Work: work}}
+	requests := []Request{
+		&testRequest{jobid: "job_1", workerid: "worker_1"},
+		&testRequest{jobid: "job_2", workerid: "worker_1"},
+	}
+
+	res := executeAll(t, workers, requests, Ordering(FIFO{}))
+	if len(res) != 2 {
+		t.Fatalf("expected 2 responses, found %d", len(res))
+	}
+	for _, r := range res {
+		if perr, ok := r.(*PanicError); ok {
+			if perr.Request.JobID() != "job_1" || len(perr.Stack) == 0 {
+				t.Errorf("unexpected panic error %v", perr)
+			}
+			continue
+		}
+		if !r.Success() {
+			t.Errorf("unexpected failure %v", r)
+		}
+	}
 }